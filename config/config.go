@@ -5,29 +5,43 @@ import (
 	"fmt"
 	"github.com/reusedev/draw-hub/internal/modules/ai"
 	"net/url"
-	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/reusedev/draw-hub/internal/consts"
 	"gopkg.in/yaml.v3"
 )
 
-var GConfig *Config
+// gConfig 当前配置，重新加载时整体替换，读取方通过 Get 获取快照，不要修改
+var gConfig atomic.Pointer[Config]
+
+// Get 当前配置；同一次处理中多次读取时应保存返回值，避免前后使用不同版本的配置
+func Get() *Config {
+	return gConfig.Load()
+}
 
 func Init(data []byte) {
-	initFromYaml(data)
-	err := GConfig.Verify()
+	c := initFromYaml(data)
+	err := c.Verify()
 	if err != nil {
 		panic(err)
 	}
+	gConfig.Store(c)
 }
 
-func initFromYaml(config []byte) {
-	err := yaml.Unmarshal(config, &GConfig)
+func initFromYaml(config []byte) *Config {
+	var c *Config
+	err := yaml.Unmarshal(config, &c)
 	if err != nil {
 		panic(err)
 	}
+	if c == nil {
+		panic("config file is empty")
+	}
+	return c
 }
 
 type Config struct {
@@ -45,8 +59,24 @@ type Config struct {
 	URLExpires            string `yaml:"url_expires"`
 	AliOss                `yaml:"ali_oss"`
 	MySQL                 `yaml:"mysql"`
-	Token                 []Token `yaml:"token"`
+	Suppliers             []Supplier `yaml:"suppliers"`
+	Token                 []Token    `yaml:"token"`
 	RequestOrder          `yaml:"request_order"`
+	ModelProviders        map[string]string `yaml:"model_providers"`
+	TokenBan              `yaml:"token_ban"`
+	RateLimit             `yaml:"rate_limit"`
+	ErrorRules            []ErrorRule `yaml:"error_rules"`
+	CircuitBreaker        `yaml:"circuit_breaker"`
+	Routing               `yaml:"routing"`
+	Hedge                 map[string]int `yaml:"hedge"`
+	Prices                []Price        `yaml:"prices"`
+	Admin                 `yaml:"admin"`
+	Probe                 `yaml:"probe"`
+	TaskQueue             `yaml:"task_queue"`
+	TaskRecovery          `yaml:"task_recovery"`
+	TaskTimeout           `yaml:"task_timeout"`
+	PostProcess           `yaml:"post_process"`
+	Webhook               `yaml:"webhook"`
 }
 
 func (c *Config) Verify() error {
@@ -81,6 +111,171 @@ func (c *Config) Verify() error {
 	if err != nil {
 		return err
 	}
+	for name, v := range map[string]string{
+		"window":        c.CircuitBreaker.Window,
+		"open_duration": c.CircuitBreaker.OpenDuration,
+	} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("circuit_breaker.%s is not a valid duration: %v", name, err)
+		}
+	}
+	if c.CircuitBreaker.MinRequests < 0 {
+		return fmt.Errorf("circuit_breaker.min_requests must be non-negative")
+	}
+	if c.CircuitBreaker.ErrorRate < 0 || c.CircuitBreaker.ErrorRate > 1 {
+		return fmt.Errorf("circuit_breaker.error_rate must be between 0 and 1")
+	}
+	if c.Routing.Default != "" {
+		if err := ai.RoutingStrategy(c.Routing.Default).Valid(); err != nil {
+			return fmt.Errorf("routing.default: %v", err)
+		}
+	}
+	for model, strategies := range c.Routing.Models {
+		for i, v := range strategies {
+			if err := ai.RoutingStrategy(v).Valid(); err != nil {
+				return fmt.Errorf("routing.models.%s[%d]: %v", model, i, err)
+			}
+		}
+	}
+	for model, kind := range c.ModelProviders {
+		if _, ok := c.RequestOrder[model]; !ok {
+			return fmt.Errorf("model_providers.%s: model not found in request_order", model)
+		}
+		if !consts.ProviderKind(kind).Valid() {
+			return fmt.Errorf("model_providers.%s: invalid provider %s", model, kind)
+		}
+	}
+	if _, err := c.supplierConfigs(); err != nil {
+		return err
+	}
+	if _, err := c.errorRules(); err != nil {
+		return err
+	}
+	for name, v := range map[string]string{
+		"interval": c.Probe.Interval,
+		"timeout":  c.Probe.Timeout,
+		"ban":      c.Probe.Ban,
+	} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("probe.%s must be a positive duration", name)
+		}
+	}
+	for name, v := range map[string]string{
+		"max_wait": c.RateLimit.MaxWait,
+		"backoff":  c.RateLimit.Backoff,
+	} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			return fmt.Errorf("rate_limit.%s must be a non-negative duration", name)
+		}
+	}
+	if c.Probe.FailureThreshold < 0 {
+		return fmt.Errorf("probe.failure_threshold must be non-negative")
+	}
+	for _, v := range c.Token {
+		if !c.knownSupplier(v.Supplier) {
+			return fmt.Errorf("token %s/%s: supplier not found in suppliers", v.Supplier, v.Desc)
+		}
+		if v.RateLimit.RPM < 0 || v.RateLimit.Burst < 0 {
+			return fmt.Errorf("token %s/%s: rate_limit must be non-negative", v.Supplier, v.Desc)
+		}
+		if v.Budget.Requests < 0 || v.Budget.Amount < 0 {
+			return fmt.Errorf("token %s/%s: budget must be non-negative", v.Supplier, v.Desc)
+		}
+		if v.Budget.Limited() && v.Budget.Period != BudgetPeriodDay && v.Budget.Period != BudgetPeriodMonth {
+			return fmt.Errorf("token %s/%s: budget.period must be %s or %s", v.Supplier, v.Desc, BudgetPeriodDay, BudgetPeriodMonth)
+		}
+	}
+	for _, v := range c.Prices {
+		if v.Price < 0 {
+			return fmt.Errorf("prices: price of %s/%s/%s must be non-negative", v.Supplier, v.Desc, v.Model)
+		}
+	}
+	for model, n := range c.Hedge {
+		if n < 0 {
+			return fmt.Errorf("hedge.%s must be non-negative", model)
+		}
+		if n > 1 && c.ProviderKind(model) != consts.ProviderChatImage {
+			return fmt.Errorf("hedge.%s: parallel requests are only supported for %s models", model, consts.ProviderChatImage)
+		}
+	}
+	if c.TaskQueue.MaxWorkers < 0 {
+		return fmt.Errorf("task_queue.max_workers must be non-negative")
+	}
+	for model, limit := range c.TaskQueue.ModelConcurrency {
+		if limit < 0 {
+			return fmt.Errorf("task_queue.model_concurrency.%s must be non-negative", model)
+		}
+	}
+	if c.TaskQueue.AgingInterval != "" {
+		if _, err := time.ParseDuration(c.TaskQueue.AgingInterval); err != nil {
+			return fmt.Errorf("task_queue.aging_interval is not a valid duration: %v", err)
+		}
+	}
+	if c.TaskQueue.Durable {
+		ttl, err := time.ParseDuration(c.TaskQueue.LeaseTTL)
+		if err != nil || ttl < 3*time.Second {
+			return fmt.Errorf("task_queue.lease_ttl must be a duration of at least 3s")
+		}
+		if _, err := time.ParseDuration(c.TaskQueue.PollInterval); err != nil {
+			return fmt.Errorf("task_queue.poll_interval is not a valid duration: %v", err)
+		}
+	}
+	if c.TaskRecovery.StaleAfter != "" {
+		if _, err := time.ParseDuration(c.TaskRecovery.StaleAfter); err != nil {
+			return fmt.Errorf("task_recovery.stale_after is not a valid duration: %v", err)
+		}
+		if _, err := time.ParseDuration(c.TaskRecovery.Interval); err != nil {
+			return fmt.Errorf("task_recovery.interval is not a valid duration: %v", err)
+		}
+		if c.TaskRecovery.Policy != RecoveryPolicyRequeue && c.TaskRecovery.Policy != RecoveryPolicyFail {
+			return fmt.Errorf("task_recovery.policy must be %s or %s", RecoveryPolicyRequeue, RecoveryPolicyFail)
+		}
+	}
+	if c.TaskTimeout.Default != "" {
+		if _, err := time.ParseDuration(c.TaskTimeout.Default); err != nil {
+			return fmt.Errorf("task_timeout.default is not a valid duration: %v", err)
+		}
+	}
+	for model, v := range c.TaskTimeout.Models {
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("task_timeout.models.%s is not a valid duration: %v", model, err)
+		}
+	}
+	if c.PostProcess.MaxAttempts < 0 {
+		return fmt.Errorf("post_process.max_attempts must be non-negative")
+	}
+	if c.PostProcess.RetryInterval != "" {
+		if _, err := time.ParseDuration(c.PostProcess.RetryInterval); err != nil {
+			return fmt.Errorf("post_process.retry_interval is not a valid duration: %v", err)
+		}
+	}
+	for name, v := range map[string]string{
+		"initial_backoff": c.Webhook.InitialBackoff,
+		"max_backoff":     c.Webhook.MaxBackoff,
+		"timeout":         c.Webhook.Timeout,
+	} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("webhook.%s is not a valid duration: %v", name, err)
+		}
+	}
+	if c.Webhook.MaxAttempts < 0 {
+		return fmt.Errorf("webhook.max_attempts must be non-negative")
+	}
+	if c.Webhook.Enabled && c.Webhook.Secret == "" {
+		return fmt.Errorf("webhook.secret is required when webhook is enabled")
+	}
 	return nil
 }
 
@@ -104,35 +299,334 @@ type MySQL struct {
 	MaxOpenConns int    `yaml:"max_open_conns"`
 }
 
+type TaskQueue struct {
+	MaxWorkers       int            `yaml:"max_workers"`       // 全局最大并发任务数，0 表示不限制
+	ModelConcurrency map[string]int `yaml:"model_concurrency"` // 单模型最大并发任务数，0 或未配置表示不限制
+	AgingInterval    string         `yaml:"aging_interval"`    // 排队每满该时长优先级加 1，为空表示不提升
+	Durable          bool           `yaml:"durable"`           // 使用 MySQL 持久化队列，多实例通过租约抢占任务
+	InstanceId       string         `yaml:"instance_id"`       // 租约持有者标识，为空时使用 hostname 加随机串
+	LeaseTTL         string         `yaml:"lease_ttl"`         // 租约有效期，持有者定期续约
+	PollInterval     string         `yaml:"poll_interval"`     // 抢占任务的轮询间隔
+}
+
+const (
+	RecoveryPolicyRequeue = "requeue"
+	RecoveryPolicyFail    = "fail"
+)
+
+type TaskRecovery struct {
+	StaleAfter string `yaml:"stale_after"` // queued/running 任务超过该时长未更新视为卡住，为空表示不检测
+	Interval   string `yaml:"interval"`    // 周期检测间隔
+	Policy     string `yaml:"policy"`      // requeue 重新入队；fail 标记失败
+}
+
+type TaskTimeout struct {
+	Default string            `yaml:"default"` // 任务执行超时，为空表示不限制
+	Models  map[string]string `yaml:"models"`  // 单模型执行超时，优先于 default
+}
+
+// Duration 任务未指定超时时使用的默认值，0 表示不限制
+func (t TaskTimeout) Duration(model string) time.Duration {
+	v, ok := t.Models[model]
+	if !ok {
+		v = t.Default
+	}
+	// 配置初始化时已校验
+	d, _ := time.ParseDuration(v)
+	return d
+}
+
+type PostProcess struct {
+	MaxAttempts   int    `yaml:"max_attempts"`   // 单张图片最大处理次数，0 表示使用默认值
+	RetryInterval string `yaml:"retry_interval"` // 重试间隔，第 n 次失败后等待 n 倍
+}
+
+type Webhook struct {
+	Enabled        bool   `yaml:"enabled"`         // 关闭时不接受 callback_url
+	Secret         string `yaml:"secret"`          // 回调签名密钥，HMAC-SHA256，开启时必填
+	MaxAttempts    int    `yaml:"max_attempts"`    // 最大投递次数，0 表示使用默认值
+	InitialBackoff string `yaml:"initial_backoff"` // 首次重试间隔，之后每次翻倍
+	MaxBackoff     string `yaml:"max_backoff"`     // 重试间隔上限
+	Timeout        string `yaml:"timeout"`         // 单次投递超时
+	// 允许回调内网、回环和链路本地地址，默认拒绝以防 SSRF
+	AllowPrivateNetwork bool `yaml:"allow_private_network"`
+}
+
 type Token struct {
-	Supplier string `json:"supplier"`
-	Token    string `json:"token"`
-	Desc     string `json:"desc"`
+	Supplier  string         `json:"supplier"`
+	Token     string         `json:"token"`
+	Desc      string         `json:"desc"`
+	Budget    TokenBudget    `json:"budget"`
+	RateLimit TokenRateLimit `json:"rate_limit" yaml:"rate_limit"`
+}
+
+// TokenRateLimit 令牌桶限流，超过供应商的 RPM 限制会返回 429
+type TokenRateLimit struct {
+	RPM   int `json:"rpm"`   // 每分钟请求数，0 表示不限制
+	Burst int `json:"burst"` // 桶容量，即允许的突发请求数，默认 1
+}
+
+const (
+	BudgetPeriodDay   = "day"
+	BudgetPeriodMonth = "month"
+)
+
+// TokenBudget 按自然日或自然月计算的调用额度，用完后该 token 在下个周期前不再使用
+type TokenBudget struct {
+	Period   string  `json:"period"`   // day|month
+	Requests int     `json:"requests"` // 请求次数上限，0 表示不限制
+	Amount   float64 `json:"amount"`   // 按 prices 计算的金额上限，0 表示不限制
+}
+
+func (b TokenBudget) Limited() bool {
+	return b.Requests > 0 || b.Amount > 0
 }
 
-type RequestOrder struct {
-	GPT4oImage      [][]Request `yaml:"gpt-4o-image"`
-	GPT4oImageVip   [][]Request `yaml:"gpt-4o-image-vip"`
-	GPTImage1       [][]Request `yaml:"gpt-image-1"`
-	DeepSearch      [][]Request `yaml:"deepsearch"`
-	GPT5            [][]Request `yaml:"gpt-5"`
-	Gemini25Flash   [][]Request `yaml:"gemini-2.5-flash-image"`
-	Gemini25FlashHD [][]Request `yaml:"gemini-2.5-flash-image-hd"`
-	Gemini3Pro      [][]Request `yaml:"gemini-3-pro-image-preview"`
-	Gemini3Pro2k    [][]Request `yaml:"gemini-3-pro-image-preview-2k"`
-	Gemini3Pro4k    [][]Request `yaml:"gemini-3-pro-image-preview-4k"`
-	JiMengV40       [][]Request `yaml:"jimeng_t2i_v40"`
-	Midjourney      [][]Request `yaml:"midjourney"`
+// RequestOrder 模型分类 -> token 分组，分组按顺序尝试
+type RequestOrder map[string][][]Request
+
+type Supplier struct {
+	Name           string            `yaml:"name"`            // 与 token.supplier 对应；与内置的 geek/tuzi/v3 同名时覆盖内置配置
+	BaseURL        string            `yaml:"base_url"`        // OpenAI 兼容接口地址
+	AuthHeader     string            `yaml:"auth_header"`     // 鉴权请求头，默认 Authorization
+	AuthScheme     string            `yaml:"auth_scheme"`     // bearer|raw，raw 表示请求头直接为 token，默认 bearer
+	Headers        map[string]string `yaml:"headers"`         // 额外请求头
+	Proxy          string            `yaml:"proxy"`           // http/https/socks5 代理地址
+	Timeout        string            `yaml:"timeout"`         // 单次请求超时，为空表示同步请求 10m、异步请求 120s
+	ConnectTimeout string            `yaml:"connect_timeout"` // 建立连接超时
+}
+
+func (c *Config) supplierConfigs() (map[consts.ModelSupplier]ai.SupplierConfig, error) {
+	ret := make(map[consts.ModelSupplier]ai.SupplierConfig, len(c.Suppliers))
+	for _, v := range c.Suppliers {
+		if v.Name == "" {
+			return nil, fmt.Errorf("suppliers: name is required")
+		}
+		if _, ok := ret[consts.ModelSupplier(v.Name)]; ok {
+			return nil, fmt.Errorf("suppliers.%s: duplicate supplier", v.Name)
+		}
+		u, err := url.Parse(v.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("suppliers.%s: base_url must be a http(s) URL", v.Name)
+		}
+		if v.AuthScheme != "" && v.AuthScheme != ai.AuthSchemeBearer && v.AuthScheme != ai.AuthSchemeRaw {
+			return nil, fmt.Errorf("suppliers.%s: auth_scheme must be %s or %s", v.Name, ai.AuthSchemeBearer, ai.AuthSchemeRaw)
+		}
+		conf := ai.SupplierConfig{
+			BaseURL:    v.BaseURL,
+			AuthHeader: v.AuthHeader,
+			AuthScheme: v.AuthScheme,
+			Headers:    v.Headers,
+		}
+		if v.Proxy != "" {
+			proxy, err := url.Parse(v.Proxy)
+			if err != nil || (proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5") {
+				return nil, fmt.Errorf("suppliers.%s: proxy must be a http, https or socks5 URL", v.Name)
+			}
+			conf.Proxy = proxy
+		}
+		for _, d := range []struct {
+			name  string
+			value string
+			dst   *time.Duration
+		}{
+			{"timeout", v.Timeout, &conf.Timeout},
+			{"connect_timeout", v.ConnectTimeout, &conf.ConnectTimeout},
+		} {
+			if d.value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(d.value)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("suppliers.%s: %s must be a positive duration", v.Name, d.name)
+			}
+			*d.dst = duration
+		}
+		ret[consts.ModelSupplier(v.Name)] = conf
+	}
+	return ret, nil
+}
+
+// knownSupplier 供应商在 suppliers 中配置或为内置供应商
+func (c *Config) knownSupplier(name string) bool {
+	for _, v := range c.Suppliers {
+		if v.Name == name {
+			return true
+		}
+	}
+	return consts.ModelSupplier(name).BaseURL() != ""
+}
+
+type ErrorRule struct {
+	Name        string   `yaml:"name"`
+	Suppliers   []string `yaml:"suppliers"`    // 为空表示所有供应商
+	Models      []string `yaml:"models"`       // 供应商模型，即 request_order 中的 model，为空表示所有模型
+	StatusCodes []int    `yaml:"status_codes"` // 为空表示所有状态码
+	Body        string   `yaml:"body"`         // 匹配响应体的正则
+	JSONPath    string   `yaml:"json_path"`    // 如 error.code、errors[0].message
+	JSONMatch   string   `yaml:"json_match"`   // 匹配 json_path 取值的正则，为空表示路径存在即可
+	Action      string   `yaml:"action"`       // prompt_violation|ban_token|retry|insufficient_balance|skip
+	Ban         string   `yaml:"ban"`          // ban_token 默认 10m，insufficient_balance 默认 24h
+	Retries     int      `yaml:"retries"`      // retry 的最大重试次数，默认 1
+}
+
+func (c *Config) errorRules() ([]ai.ErrorRule, error) {
+	ret := make([]ai.ErrorRule, 0, len(c.ErrorRules))
+	for i, v := range c.ErrorRules {
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+		rule := ai.ErrorRule{
+			Name:        name,
+			Suppliers:   v.Suppliers,
+			Models:      v.Models,
+			StatusCodes: v.StatusCodes,
+			JSONPath:    v.JSONPath,
+			Action:      ai.ErrorAction(v.Action),
+			Retries:     v.Retries,
+		}
+		if err := rule.Action.Valid(); err != nil {
+			return nil, fmt.Errorf("error_rules.%s: %v", name, err)
+		}
+		if v.Body == "" && v.JSONPath == "" && len(v.StatusCodes) == 0 {
+			return nil, fmt.Errorf("error_rules.%s: at least one of status_codes, body and json_path is required", name)
+		}
+		var err error
+		if v.Body != "" {
+			if rule.Body, err = regexp.Compile(v.Body); err != nil {
+				return nil, fmt.Errorf("error_rules.%s: invalid body regexp: %v", name, err)
+			}
+		}
+		if v.JSONPath != "" {
+			if err := ai.ValidJSONPath(v.JSONPath); err != nil {
+				return nil, fmt.Errorf("error_rules.%s: %v", name, err)
+			}
+		}
+		if v.JSONMatch != "" {
+			if v.JSONPath == "" {
+				return nil, fmt.Errorf("error_rules.%s: json_match requires json_path", name)
+			}
+			if rule.JSONMatch, err = regexp.Compile(v.JSONMatch); err != nil {
+				return nil, fmt.Errorf("error_rules.%s: invalid json_match regexp: %v", name, err)
+			}
+		}
+		if v.Ban != "" {
+			if rule.Ban, err = time.ParseDuration(v.Ban); err != nil || rule.Ban <= 0 {
+				return nil, fmt.Errorf("error_rules.%s: ban must be a positive duration", name)
+			}
+		}
+		if v.Retries < 0 {
+			return nil, fmt.Errorf("error_rules.%s: retries must be non-negative", name)
+		}
+		ret = append(ret, rule)
+	}
+	return ai.MergeErrorRules(ret), nil
+}
+
+type Probe struct {
+	Enabled          bool   `yaml:"enabled"`
+	Interval         string `yaml:"interval"`          // 探测间隔，默认 1m
+	Timeout          string `yaml:"timeout"`           // 单次探测超时，默认 10s
+	Path             string `yaml:"path"`              // GET 请求的路径，默认 v1/models
+	FailureThreshold int    `yaml:"failure_threshold"` // 连续失败达到该次数时熔断 token，默认 3
+	Ban              string `yaml:"ban"`               // 熔断时长，默认 5m；期间探测成功会提前恢复
+}
+
+type Admin struct {
+	Token string `yaml:"token"` // 管理接口的访问令牌，请求头 Authorization: Bearer <token>；为空表示关闭管理接口
+}
+
+type RateLimit struct {
+	MaxWait string `yaml:"max_wait"` // 所有 token 都被限流时最多等待的时间，默认 3s，0s 表示不等待直接失败
+	Backoff string `yaml:"backoff"`  // 供应商返回 429 后暂停使用该 token 的时间，默认 30s
+}
+
+// Config 未配置的字段使用默认值
+func (r RateLimit) Config() ai.RateLimitConfig {
+	conf := ai.DefaultRateLimitConfig
+	if d, err := time.ParseDuration(r.MaxWait); err == nil && d >= 0 {
+		conf.MaxWait = d
+	}
+	if d, err := time.ParseDuration(r.Backoff); err == nil && d > 0 {
+		conf.Backoff = d
+	}
+	return conf
+}
+
+type TokenBan struct {
+	EscalateSupplier bool `yaml:"escalate_supplier"` // 某模型下一个供应商的 token 全部熔断时，在所有模型下熔断该供应商
+}
+
+type CircuitBreaker struct {
+	Window       string  `yaml:"window"`        // 统计错误率的滚动窗口
+	MinRequests  int     `yaml:"min_requests"`  // 窗口内请求数达到该值才判断是否熔断
+	ErrorRate    float64 `yaml:"error_rate"`    // 错误率达到该值时熔断，0 ~ 1
+	OpenDuration string  `yaml:"open_duration"` // 熔断持续时间，之后放行一个试探请求，成功则恢复
+}
+
+// Config 未配置的字段使用默认值
+func (c CircuitBreaker) Config() ai.BreakerConfig {
+	conf := ai.DefaultBreakerConfig
+	if d, err := time.ParseDuration(c.Window); err == nil && d > 0 {
+		conf.Window = d
+	}
+	if c.MinRequests > 0 {
+		conf.MinRequests = c.MinRequests
+	}
+	if c.ErrorRate > 0 {
+		conf.ErrorRate = c.ErrorRate
+	}
+	if d, err := time.ParseDuration(c.OpenDuration); err == nil && d > 0 {
+		conf.OpenDuration = d
+	}
+	return conf
+}
+
+type Routing struct {
+	Default string              `yaml:"default"` // 分组内 token 的选择策略，为空表示 ordered
+	Models  map[string][]string `yaml:"models"`  // 单模型按 request_order 分组顺序配置策略，优先于 default
+}
+
+func (r Routing) Strategies() (ai.RoutingStrategy, map[string][]ai.RoutingStrategy) {
+	ret := make(map[string][]ai.RoutingStrategy)
+	for model, strategies := range r.Models {
+		for _, v := range strategies {
+			ret[model] = append(ret[model], ai.RoutingStrategy(v))
+		}
+	}
+	if r.Default == "" {
+		return ai.RoutingOrdered, ret
+	}
+	return ai.RoutingStrategy(r.Default), ret
+}
+
+type Price struct {
+	Supplier string  `yaml:"supplier"`
+	Desc     string  `yaml:"desc"`
+	Model    string  `yaml:"model"` // 供应商模型，即 request_order 中的 model
+	Price    float64 `yaml:"price"` // 单次请求价格
+}
+
+// Price 供应商 token 调用该模型的单次价格，未配置时为 0
+func (c *Config) Price(supplier, desc, model string) float64 {
+	for _, v := range c.Prices {
+		if v.Supplier == supplier && v.Desc == desc && v.Model == model {
+			return v.Price
+		}
+	}
+	return 0
 }
 
 type Request struct {
 	Supplier string `json:"supplier"`
 	Desc     string `json:"desc"`
 	Model    string `json:"model"`
+	Weight   int    `json:"weight"` // weighted 策略下的权重，默认 1
 }
 
-func getToken(supplier, desc string) string {
-	for _, token := range GConfig.Token {
+func (c *Config) getToken(supplier, desc string) string {
+	for _, token := range c.Token {
 		if token.Supplier == supplier && token.Desc == desc {
 			return token.Token
 		}
@@ -140,46 +634,32 @@ func getToken(supplier, desc string) string {
 	return ""
 }
 
-func (r *RequestOrder) Classifications() []string {
-	var result []string
-	ts := reflect.TypeOf(r).Elem()
-	for i := 0; i < ts.NumField(); i++ {
-		field := ts.Field(i)
-		classification, ok := field.Tag.Lookup("yaml")
-		if !ok {
-			continue
-		}
+func (r RequestOrder) Classifications() []string {
+	result := make([]string, 0, len(r))
+	for classification := range r {
 		result = append(result, classification)
 	}
+	sort.Strings(result)
 	return result
 }
 
-func (r *RequestOrder) Tokens() [][][]ai.TokenWithModel {
+// Tokens request_order 中各模型分类的 token，与 RequestOrder.Classifications 顺序一致
+func (c *Config) Tokens() [][][]ai.TokenWithModel {
 	var result [][][]ai.TokenWithModel
-	rv := reflect.ValueOf(r).Elem()
-	rt := rv.Type()
-	for i := 0; i < rt.NumField(); i++ {
-		field := rt.Field(i)
-		if _, ok := field.Tag.Lookup("yaml"); !ok {
-			continue
-		}
-		fieldValue := rv.Field(i)
-		if fieldValue.Type() != reflect.TypeOf([][]Request{}) {
-			continue
-		}
+	for _, classification := range c.RequestOrder.Classifications() {
 		var classificationTokens [][]ai.TokenWithModel
-		for j := 0; j < fieldValue.Len(); j++ {
-			tokenGroup := fieldValue.Index(j)
+		for _, group := range c.RequestOrder[classification] {
 			var tokens []ai.TokenWithModel
-			for k := 0; k < tokenGroup.Len(); k++ {
-				request := tokenGroup.Index(k).Interface().(Request)
+			for _, request := range group {
 				token := ai.TokenWithModel{
 					Token: ai.Token{
 						Supplier: consts.ModelSupplier(request.Supplier),
-						Token:    getToken(request.Supplier, request.Desc),
+						Token:    c.getToken(request.Supplier, request.Desc),
 						Desc:     request.Desc,
 					},
-					Model: request.Model,
+					Model:  request.Model,
+					Weight: request.Weight,
+					Price:  c.Price(request.Supplier, request.Desc, request.Model),
 				}
 				tokens = append(tokens, token)
 			}
@@ -190,9 +670,55 @@ func (r *RequestOrder) Tokens() [][][]ai.TokenWithModel {
 	return result
 }
 
+// ProviderKind 模型分类使用的供应商接口，未在 model_providers 中配置时按模型名推断，无法推断时为空
+func (c *Config) ProviderKind(model string) consts.ProviderKind {
+	if kind, ok := c.ModelProviders[model]; ok {
+		return consts.ProviderKind(kind)
+	}
+	switch {
+	case strings.HasPrefix(model, "gemini"):
+		return consts.ProviderChatImage
+	case strings.HasPrefix(model, "jimeng"):
+		return consts.ProviderSeedream
+	case model == consts.MidJourney.String():
+		return consts.ProviderMidjourney
+	case model == consts.GPTImage1.String():
+		return consts.ProviderOpenAIImages
+	case strings.HasPrefix(model, consts.GPT4oImage.String()):
+		return consts.ProviderGPT4oChat
+	}
+	return ""
+}
+
 func InitTokenManager(ctx context.Context) {
-	err := ai.InitTokenManager(ctx, GConfig.RequestOrder.Classifications(), GConfig.RequestOrder.Tokens())
+	c := Get()
+	c.applySuppliers()
+	err := ai.InitTokenManager(ctx, c.RequestOrder.Classifications(), c.Tokens(), c.tokenManagerOptions()...)
 	if err != nil {
 		panic(err)
 	}
 }
+
+// applySuppliers 更新供应商接入、错误识别规则和限流，配置需已通过 Verify
+func (c *Config) applySuppliers() {
+	suppliers, _ := c.supplierConfigs()
+	ai.SetSuppliers(suppliers)
+	rules, _ := c.errorRules()
+	ai.SetErrorRules(rules)
+	limits := make(map[ai.TokenKey]ai.RateLimit)
+	for _, v := range c.Token {
+		if v.RateLimit.RPM > 0 {
+			limits[ai.TokenKey{Supplier: consts.ModelSupplier(v.Supplier), Desc: v.Desc}] = ai.RateLimit{RPM: v.RateLimit.RPM, Burst: v.RateLimit.Burst}
+		}
+	}
+	ai.SetRateLimits(limits, c.RateLimit.Config())
+}
+
+func (c *Config) tokenManagerOptions() []ai.Option {
+	return []ai.Option{
+		ai.WithSupplierBanEscalation(c.TokenBan.EscalateSupplier),
+		ai.WithBreakerConfig(c.CircuitBreaker.Config()),
+		ai.WithRouting(c.Routing.Strategies()),
+		ai.WithHedge(c.Hedge),
+	}
+}
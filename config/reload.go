@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	filePath    string
+	reloadLock  sync.Mutex
+	reloadHooks []func()
+)
+
+// InitFile 读取配置文件并记录路径，供 Reload 重新读取
+func InitFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	filePath = path
+	Init(data)
+}
+
+// OnReload 配置重新加载成功后调用
+func OnReload(hook func()) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// Reload 重新读取配置文件，校验通过后替换 token、请求顺序、熔断、路由、价格和管理接口配置并重建 TokenManager。
+// 其他配置（端口、MySQL、队列等）需重启生效
+func Reload() error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	if filePath == "" {
+		return fmt.Errorf("config file path unknown")
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var c *Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("config file is empty")
+	}
+	if err := c.Verify(); err != nil {
+		return err
+	}
+	next := *Get()
+	next.Suppliers = c.Suppliers
+	next.Token = c.Token
+	next.RequestOrder = c.RequestOrder
+	next.ModelProviders = c.ModelProviders
+	next.TokenBan = c.TokenBan
+	next.RateLimit = c.RateLimit
+	next.ErrorRules = c.ErrorRules
+	next.CircuitBreaker = c.CircuitBreaker
+	next.Routing = c.Routing
+	next.Hedge = c.Hedge
+	next.Prices = c.Prices
+	next.Admin = c.Admin
+	next.Probe = c.Probe
+	err = ai.ReloadTokenManager(next.RequestOrder.Classifications(), next.Tokens(), next.tokenManagerOptions()...)
+	if err != nil {
+		return err
+	}
+	gConfig.Store(&next)
+	next.applySuppliers()
+	for _, hook := range reloadHooks {
+		hook()
+	}
+	return nil
+}
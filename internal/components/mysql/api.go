@@ -40,7 +40,7 @@ func CreateDataBase(config config.MySQL) {
 func FieldMigrate() {
 	err := DB.Exec(`
         ALTER TABLE task
-        MODIFY COLUMN status ENUM('pending', 'queued', 'running', 'succeed', 'aborted', 'failed')
+        MODIFY COLUMN status ENUM('pending', 'queued', 'running', 'succeed', 'aborted', 'failed', 'cancelled')
     `).Error
 	if err != nil {
 		panic(fmt.Sprintf("Failed to migrate tasks table: %v", err))
@@ -47,6 +47,29 @@ func (m Model) String() string {
 	return string(m)
 }
 
+// ProviderKind 模型分类使用的供应商接口类型
+type ProviderKind string
+
+const (
+	ProviderChatImage    ProviderKind = "chat-image"    // chat completions 返回图片，如 gemini
+	ProviderOpenAIImages ProviderKind = "openai-images" // /v1/images 接口，如 gpt-image-1
+	ProviderMidjourney   ProviderKind = "midjourney"
+	ProviderSeedream     ProviderKind = "seedream"    // 即梦
+	ProviderGPT4oChat    ProviderKind = "gpt-4o-chat" // chat completions 返回图片链接，如 gpt-4o-image
+)
+
+func (p ProviderKind) String() string {
+	return string(p)
+}
+
+func (p ProviderKind) Valid() bool {
+	switch p {
+	case ProviderChatImage, ProviderOpenAIImages, ProviderMidjourney, ProviderSeedream, ProviderGPT4oChat:
+		return true
+	}
+	return false
+}
+
 type TaskSpeed string
 
 const (
@@ -76,4 +99,6 @@ func (t TaskType) String() string {
 const (
 	EventTaskEnd = iota
 	EventSysExit
+	EventAttempt  // 单次供应商调用开始/结束
+	EventProgress // 供应商返回的生成进度
 )
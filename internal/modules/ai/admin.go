@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"time"
+)
+
+type TokenState struct {
+	Group     int        `json:"group"` // request_order 中的分组下标
+	Supplier  string     `json:"supplier"`
+	Desc      string     `json:"desc"`
+	Model     string     `json:"model"`
+	Weight    int        `json:"weight"`
+	Price     float64    `json:"price"`
+	Disabled  bool       `json:"disabled"`
+	DrainedAt *time.Time `json:"drained_at,omitempty"`
+	BreakerSnapshot
+	LatencyMs   float64 `json:"latency_ms"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+type ManagerState struct {
+	Clients int          `json:"clients"` // 已创建的迭代器数量
+	Tokens  []TokenState `json:"tokens"`
+}
+
+func (t *TokenManager) State() ManagerState {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	now := time.Now()
+	ret := ManagerState{Clients: len(t.Client), Tokens: make([]TokenState, 0)}
+	for i, tokens := range t.Token {
+		for _, token := range tokens {
+			key := token.Key()
+			s := TokenState{
+				Group:           i,
+				Supplier:        token.Supplier.String(),
+				Desc:            token.Desc,
+				Model:           token.Model,
+				Weight:          token.weight(),
+				Price:           token.Price,
+				Disabled:        t.disabled[key],
+				BreakerSnapshot: t.breaker(key).Snapshot(now),
+				LatencyMs:       t.stats(token.Token).latencyMs,
+				SuccessRate:     t.successRate(token.Token),
+			}
+			if v, ok := t.drained[key]; ok {
+				s.DrainedAt = &v
+			}
+			ret.Tokens = append(ret.Tokens, s)
+		}
+	}
+	return ret
+}
+
+// Has 该模型是否配置了这个 token
+func (t *TokenManager) Has(key TokenKey) bool {
+	for _, tokens := range t.Token {
+		for _, token := range tokens {
+			if token.Key() == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unban 关闭熔断，清空错误统计
+func (t *TokenManager) Unban(key TokenKey) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	t.breaker(key).Reset()
+}
+
+// Release 仅当熔断截止时间仍为 until 时解除熔断，用于撤销 Extend 设置的熔断而不影响之后的手动熔断或更长的熔断
+func (t *TokenManager) Release(key TokenKey, until time.Time) bool {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	b := t.breaker(key)
+	if b.state == BreakerClosed || !b.openUntil.Equal(until) {
+		return false
+	}
+	b.Reset()
+	return true
+}
+
+// Drain 已经在使用该 token 的迭代器可以继续使用，之后创建的迭代器跳过它
+func (t *TokenManager) Drain(key TokenKey) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	t.setDrained(key, time.Now())
+}
+
+// Disable 所有迭代器都不再使用该 token
+func (t *TokenManager) Disable(key TokenKey) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	t.setDisabled(key, true)
+}
+
+// Enable 撤销 Drain 和 Disable
+func (t *TokenManager) Enable(key TokenKey) {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	delete(t.drained, key)
+	t.setDisabled(key, false)
+}
+
+func (t *TokenManager) setDrained(key TokenKey, at time.Time) {
+	if t.drained == nil {
+		t.drained = make(map[TokenKey]time.Time)
+	}
+	t.drained[key] = at
+}
+
+func (t *TokenManager) setDisabled(key TokenKey, disabled bool) {
+	if !disabled {
+		delete(t.disabled, key)
+		return
+	}
+	if t.disabled == nil {
+		t.disabled = make(map[TokenKey]bool)
+	}
+	t.disabled[key] = true
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrainAndDisable(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-2", Desc: "default", Supplier: consts.Geek}, Model: "gpt-4o-image"},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	tuzi := TokenKey{Supplier: consts.Tuzi, Desc: "default"}
+	geek := TokenKey{Supplier: consts.Geek, Desc: "default"}
+
+	inFlight := m.GetTokenIterator()
+	m.Disable(tuzi)
+	require.Equal(t, "sk-2", inFlight().Token.Token)
+	m.Enable(tuzi)
+	time.Sleep(time.Millisecond)
+	m.Drain(tuzi)
+
+	// 排空前已经开始的迭代器仍可使用该 token
+	require.Equal(t, "sk-1", inFlight().Token.Token)
+	require.Nil(t, inFlight())
+
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Nil(t, getToken())
+
+	m.Disable(geek)
+	require.Nil(t, m.GetTokenIterator()())
+	m.Enable(geek)
+
+	state := m.State()
+	require.Equal(t, 3, state.Clients)
+	require.NotNil(t, state.Tokens[0].DrainedAt)
+	require.False(t, state.Tokens[1].Disabled)
+
+	m.Ban(Token{Desc: "default", Supplier: consts.Geek}, time.Now().Add(time.Hour))
+	require.Equal(t, BreakerOpen, m.State().Tokens[1].State)
+	m.Unban(geek)
+	require.Equal(t, BreakerClosed, m.State().Tokens[1].State)
+}
@@ -0,0 +1,161 @@
+package ai
+
+import (
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+type BreakerConfig struct {
+	Window       time.Duration // 统计错误率的滚动窗口
+	MinRequests  int           // 窗口内请求数达到该值才判断是否熔断
+	ErrorRate    float64       // 错误率达到该值时熔断，0 ~ 1
+	OpenDuration time.Duration // 熔断持续时间，之后进入 half-open 放行一个试探请求
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	Window:       5 * time.Minute,
+	MinRequests:  5,
+	ErrorRate:    0.5,
+	OpenDuration: 10 * time.Minute,
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+// Breaker 单个 token 的熔断器，由 TokenManager 加锁访问
+type Breaker struct {
+	conf      BreakerConfig
+	state     BreakerState
+	openedAt  time.Time
+	openUntil time.Time
+	trialAt   time.Time // half-open 试探请求的开始时间，零值表示没有进行中的试探
+	outcomes  []outcome
+}
+
+type BreakerSnapshot struct {
+	State     BreakerState `json:"state"`
+	Requests  int          `json:"requests"`
+	Failures  int          `json:"failures"`
+	ErrorRate float64      `json:"error_rate"`
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"`
+	OpenUntil *time.Time   `json:"open_until,omitempty"`
+}
+
+func NewBreaker(conf BreakerConfig) *Breaker {
+	return &Breaker{conf: conf, state: BreakerClosed}
+}
+
+func (b *Breaker) State(now time.Time) BreakerState {
+	if b.state == BreakerOpen && !now.Before(b.openUntil) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Available 是否可以发起请求；half-open 状态只允许一个试探请求
+func (b *Breaker) Available(now time.Time) bool {
+	switch b.State(now) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		// 试探请求长时间没有结果时（如任务被取消）允许重新试探
+		return b.trialAt.IsZero() || now.Sub(b.trialAt) > b.conf.OpenDuration
+	default:
+		return false
+	}
+}
+
+// Acquire 发起请求前调用，half-open 状态下占用试探名额
+func (b *Breaker) Acquire(now time.Time) {
+	if b.State(now) != BreakerHalfOpen {
+		return
+	}
+	b.state = BreakerHalfOpen
+	b.trialAt = now
+}
+
+// Record 记录请求结果，返回本次是否触发熔断
+func (b *Breaker) Record(now time.Time, success bool) bool {
+	switch b.state {
+	case BreakerHalfOpen:
+		if success {
+			b.state = BreakerClosed
+			b.trialAt = time.Time{}
+			b.outcomes = nil
+			return false
+		}
+		b.open(now, now.Add(b.conf.OpenDuration))
+		return true
+	case BreakerOpen:
+		// 熔断前发出的请求，结果不再计入
+		return false
+	}
+	b.outcomes = append(b.outcomes, outcome{at: now, failed: !success})
+	b.prune(now)
+	requests, failures := b.count()
+	if requests >= b.conf.MinRequests && float64(failures)/float64(requests) >= b.conf.ErrorRate {
+		b.open(now, now.Add(b.conf.OpenDuration))
+		return true
+	}
+	return false
+}
+
+// ForceOpen 手动熔断到 until
+func (b *Breaker) ForceOpen(now, until time.Time) {
+	b.open(now, until)
+}
+
+// Reset 手动恢复，清空统计
+func (b *Breaker) Reset() {
+	b.state = BreakerClosed
+	b.trialAt = time.Time{}
+	b.outcomes = nil
+}
+
+func (b *Breaker) open(now, until time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.openUntil = until
+	b.trialAt = time.Time{}
+	b.outcomes = nil
+}
+
+func (b *Breaker) prune(now time.Time) {
+	i := 0
+	for i < len(b.outcomes) && now.Sub(b.outcomes[i].at) > b.conf.Window {
+		i++
+	}
+	b.outcomes = b.outcomes[i:]
+}
+
+func (b *Breaker) count() (requests, failures int) {
+	for _, v := range b.outcomes {
+		if v.failed {
+			failures++
+		}
+	}
+	return len(b.outcomes), failures
+}
+
+func (b *Breaker) Snapshot(now time.Time) BreakerSnapshot {
+	b.prune(now)
+	requests, failures := b.count()
+	s := BreakerSnapshot{State: b.State(now), Requests: requests, Failures: failures}
+	if requests > 0 {
+		s.ErrorRate = float64(failures) / float64(requests)
+	}
+	if b.state != BreakerClosed {
+		openedAt, openUntil := b.openedAt, b.openUntil
+		s.OpenedAt, s.OpenUntil = &openedAt, &openUntil
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(BreakerConfig{Window: time.Minute, MinRequests: 4, ErrorRate: 0.5, OpenDuration: time.Minute})
+	now := time.Now()
+
+	require.False(t, b.Record(now, false))
+	require.False(t, b.Record(now, true))
+	require.False(t, b.Record(now, true))
+	require.True(t, b.Available(now))
+	// 窗口内 4 个请求 2 个失败，达到错误率
+	require.True(t, b.Record(now, false))
+	require.Equal(t, BreakerOpen, b.State(now))
+	require.False(t, b.Available(now))
+
+	later := now.Add(time.Minute)
+	require.Equal(t, BreakerHalfOpen, b.State(later))
+	require.True(t, b.Available(later))
+	b.Acquire(later)
+	// 只放行一个试探请求
+	require.False(t, b.Available(later))
+	require.True(t, b.Record(later, false))
+	require.Equal(t, BreakerOpen, b.State(later))
+
+	later = later.Add(time.Minute)
+	b.Acquire(later)
+	require.False(t, b.Record(later, true))
+	require.Equal(t, BreakerClosed, b.State(later))
+	require.Equal(t, 0, b.Snapshot(later).Requests)
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b := NewBreaker(BreakerConfig{Window: time.Minute, MinRequests: 2, ErrorRate: 0.5, OpenDuration: time.Minute})
+	now := time.Now()
+	require.False(t, b.Record(now, false))
+	// 上一次失败已滑出窗口
+	require.False(t, b.Record(now.Add(2*time.Minute), false))
+	require.Equal(t, BreakerClosed, b.State(now.Add(2*time.Minute)))
+	require.True(t, b.Record(now.Add(2*time.Minute), false))
+}
@@ -8,7 +8,7 @@ import (
 
 func Chat(request chat.CommonRequest) []chat.Response {
 	ret := make([]chat.Response, 0)
-	getToken := ai.GTokenManager[request.Model].GetTokenIterator()
+	getToken := ai.GetTokenManager(request.Model).GetTokenIterator()
 	for {
 		token := getToken()
 		if token == nil {
@@ -24,15 +24,16 @@ func NewRequester(token ai.Token, requestTypes RequestContent, parser Parser) *R
 }
 
 func (r *Requester) Do() (Response, error) {
-	client := http_client.New()
+	supplier := ai.GetSupplier(r.token.Supplier)
+	client := &http_client.HttpClient{HttpClient: supplier.Client(120 * time.Second)}
 	body, err := r.RequestTypes.Body()
 	if err != nil {
 		return nil, err
 	}
 	req, err := client.NewRequest(
 		http.MethodPost,
-		tools.FullURL(r.token.GetSupplier().BaseURL(), r.RequestTypes.Path()),
-		http_client.WithHeader("Authorization", "Bearer "+r.token.Token),
+		tools.FullURL(supplier.BaseURL(), r.RequestTypes.Path()),
+		http_client.WithHeaders(supplier.Headers(r.token.Token)),
 		http_client.WithHeader("Content-Type", r.RequestTypes.ContentType()),
 		http_client.WithBody(body),
 	)
@@ -0,0 +1,244 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/consts"
+)
+
+type ErrorAction string
+
+const (
+	ErrorActionPromptViolation     ErrorAction = "prompt_violation"     // 违反内容政策，停止尝试其他 token
+	ErrorActionBanToken            ErrorAction = "ban_token"            // 熔断当前 token
+	ErrorActionRetry               ErrorAction = "retry"                // 使用当前 token 重试
+	ErrorActionInsufficientBalance ErrorAction = "insufficient_balance" // 余额不足，长时间熔断当前 token
+	ErrorActionSkip                ErrorAction = "skip"                 // 尝试下一个 token，不计入熔断统计
+)
+
+func (a ErrorAction) Valid() error {
+	switch a {
+	case ErrorActionPromptViolation, ErrorActionBanToken, ErrorActionRetry, ErrorActionInsufficientBalance, ErrorActionSkip:
+		return nil
+	}
+	return fmt.Errorf("invalid error action: %s", a)
+}
+
+const (
+	defaultBanDuration                 = 10 * time.Minute
+	defaultInsufficientBalanceDuration = 24 * time.Hour
+	defaultRetries                     = 1
+)
+
+// ErrorRule 按供应商、模型、状态码和响应体识别供应商返回的错误，所有条件都满足才匹配，未配置的条件不限制
+type ErrorRule struct {
+	Name        string
+	Suppliers   []string
+	Models      []string
+	StatusCodes []int
+	Body        *regexp.Regexp // 匹配原始响应体
+	JSONPath    string         // 如 error.code、$.errors[0].message，响应体不是 JSON 或路径不存在时不匹配
+	JSONMatch   *regexp.Regexp // 匹配 JSONPath 取到的值，为空表示路径存在即可
+	Action      ErrorAction
+	Ban         time.Duration // ban_token 和 insufficient_balance 的熔断时长
+	Retries     int           // retry 的最大重试次数
+}
+
+// BanDuration 未配置时 ban_token 为 10 分钟，insufficient_balance 为 24 小时
+func (r *ErrorRule) BanDuration() time.Duration {
+	if r.Ban > 0 {
+		return r.Ban
+	}
+	if r.Action == ErrorActionInsufficientBalance {
+		return defaultInsufficientBalanceDuration
+	}
+	return defaultBanDuration
+}
+
+func (r *ErrorRule) MaxRetries() int {
+	if r.Retries > 0 {
+		return r.Retries
+	}
+	return defaultRetries
+}
+
+func (r *ErrorRule) Match(supplier, model string, statusCode int, body string) bool {
+	if len(r.Suppliers) > 0 && !slices.Contains(r.Suppliers, supplier) {
+		return false
+	}
+	if len(r.Models) > 0 && !slices.Contains(r.Models, model) {
+		return false
+	}
+	if len(r.StatusCodes) > 0 && !slices.Contains(r.StatusCodes, statusCode) {
+		return false
+	}
+	if r.Body != nil && !r.Body.MatchString(body) {
+		return false
+	}
+	if r.JSONPath != "" {
+		value, ok := jsonPathValue(body, r.JSONPath)
+		if !ok {
+			return false
+		}
+		if r.JSONMatch != nil && !r.JSONMatch.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultErrorRules 内置的提示词违规规则
+var DefaultErrorRules = []ErrorRule{
+	{
+		Name:   "gpt_4o_prompt",
+		Models: []string{consts.GPT4oImage.String(), consts.GPT4oImageVip.String()},
+		Body:   regexp.MustCompile(`图片检测系统认为内容可能违反相关政策`),
+		Action: ErrorActionPromptViolation,
+	},
+	{
+		Name:      "v3_4o_vip_prompt",
+		Suppliers: []string{consts.V3.String()},
+		Models:    []string{consts.GPT4oImageVip.String()},
+		Body:      regexp.MustCompile(`输入的提示词或视频的输出内容违反了OpenAI的相关服务政策`),
+		Action:    ErrorActionPromptViolation,
+	},
+	{
+		Name:   "gpt_image_1_prompt",
+		Models: []string{consts.GPTImage1.String()},
+		Body:   regexp.MustCompile(`Your request may contain content that is not allowed by our safety system`),
+		Action: ErrorActionPromptViolation,
+	},
+	{
+		Name:   "gemini_prompt",
+		Models: []string{consts.TuziGemini3.String(), consts.TuziGemini32k.String(), consts.TuziGemini34k.String()},
+		Body:   regexp.MustCompile(`blocked by Google Gemini \(PROHIBITED_CONTENT\)`),
+		Action: ErrorActionPromptViolation,
+	},
+}
+
+// MergeErrorRules 配置的规则优先匹配，与内置规则同名时覆盖内置规则，其余内置规则排在最后
+func MergeErrorRules(rules []ErrorRule) []ErrorRule {
+	ret := make([]ErrorRule, 0, len(rules)+len(DefaultErrorRules))
+	ret = append(ret, rules...)
+	for _, v := range DefaultErrorRules {
+		if !slices.ContainsFunc(rules, func(r ErrorRule) bool { return r.Name == v.Name }) {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+var gErrorRules atomic.Pointer[[]ErrorRule]
+
+// SetErrorRules 替换错误识别规则，按顺序匹配；配置加载时传入 MergeErrorRules 的结果
+func SetErrorRules(rules []ErrorRule) {
+	gErrorRules.Store(&rules)
+}
+
+// ClassifyError 返回第一个匹配的规则，没有匹配时为 nil；未设置规则时使用内置规则
+func ClassifyError(supplier, model string, statusCode int, body string) *ErrorRule {
+	rules := gErrorRules.Load()
+	if rules == nil {
+		rules = &DefaultErrorRules
+	}
+	for i := range *rules {
+		if (*rules)[i].Match(supplier, model, statusCode, body) {
+			return &(*rules)[i]
+		}
+	}
+	return nil
+}
+
+// ValidJSONPath 校验 JSONPath 语法，只支持字段和数组下标
+func ValidJSONPath(path string) error {
+	_, err := parseJSONPath(path)
+	return err
+}
+
+type jsonPathSegment struct {
+	key   string
+	index int // key 为空时使用
+}
+
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, fmt.Errorf("empty json path")
+	}
+	var ret []jsonPathSegment
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key == "" && rest == "" {
+			return nil, fmt.Errorf("invalid json path: %s", path)
+		}
+		if key != "" {
+			ret = append(ret, jsonPathSegment{key: key})
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid json path: %s", path)
+			}
+			i, err := strconv.Atoi(idx)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("invalid json path index: %s", path)
+			}
+			ret = append(ret, jsonPathSegment{index: i})
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid json path: %s", path)
+			}
+			rest = after[1:]
+		}
+	}
+	return ret, nil
+}
+
+// jsonPathValue 字符串原样返回，其他值返回 JSON 编码
+func jsonPathValue(body, path string) (string, bool) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return "", false
+	}
+	for _, s := range segments {
+		switch node := v.(type) {
+		case map[string]any:
+			if s.key == "" {
+				return "", false
+			}
+			next, ok := node[s.key]
+			if !ok {
+				return "", false
+			}
+			v = next
+		case []any:
+			if s.key != "" || s.index >= len(node) {
+				return "", false
+			}
+			v = node[s.index]
+		default:
+			return "", false
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	SetErrorRules([]ErrorRule{
+		{
+			Name:   "prompt",
+			Models: []string{"gpt-4o-image"},
+			Body:   regexp.MustCompile("违反相关政策"),
+			Action: ErrorActionPromptViolation,
+		},
+		{
+			Name:        "balance",
+			StatusCodes: []int{401, 403},
+			JSONPath:    "$.error.code",
+			JSONMatch:   regexp.MustCompile("^insufficient_(quota|balance)$"),
+			Action:      ErrorActionInsufficientBalance,
+		},
+		{
+			Name:      "retry",
+			Suppliers: []string{"tuzi"},
+			JSONPath:  "errors[0].retryable",
+			JSONMatch: regexp.MustCompile("^true$"),
+			Action:    ErrorActionRetry,
+			Retries:   2,
+		},
+	})
+	defer gErrorRules.Store(nil)
+
+	rule := ClassifyError("tuzi", "gpt-4o-image", 200, "图片检测系统认为内容可能违反相关政策")
+	require.Equal(t, "prompt", rule.Name)
+	require.Nil(t, ClassifyError("tuzi", "gpt-image-1", 200, "图片检测系统认为内容可能违反相关政策"))
+
+	rule = ClassifyError("geek", "gpt-image-1", 403, `{"error":{"code":"insufficient_quota"}}`)
+	require.Equal(t, "balance", rule.Name)
+	require.Equal(t, 24*time.Hour, rule.BanDuration())
+	require.Nil(t, ClassifyError("geek", "gpt-image-1", 500, `{"error":{"code":"insufficient_quota"}}`))
+	require.Nil(t, ClassifyError("geek", "gpt-image-1", 403, `{"error":{"code":"invalid_api_key"}}`))
+	require.Nil(t, ClassifyError("geek", "gpt-image-1", 403, "forbidden"))
+
+	rule = ClassifyError("tuzi", "gpt-image-1", 502, `{"errors":[{"retryable":true}]}`)
+	require.Equal(t, "retry", rule.Name)
+	require.Equal(t, 2, rule.MaxRetries())
+	require.Nil(t, ClassifyError("v3", "gpt-image-1", 502, `{"errors":[{"retryable":true}]}`))
+}
+
+func TestDefaultErrorRules(t *testing.T) {
+	defer gErrorRules.Store(nil)
+
+	// 未设置规则时使用内置规则
+	rule := ClassifyError("tuzi", "gpt-4o-image", 200, "图片检测系统认为内容可能违反相关政策")
+	require.Equal(t, "gpt_4o_prompt", rule.Name)
+	rule = ClassifyError("tuzi", "gemini-3-pro-image-preview", 400,
+		"your request has been blocked by Google Gemini (PROHIBITED_CONTENT): content is prohibited under official usage policies.")
+	require.Equal(t, ErrorActionPromptViolation, rule.Action)
+
+	SetErrorRules(MergeErrorRules([]ErrorRule{
+		{
+			Name:   "gpt_4o_prompt",
+			Models: []string{"gpt-4o-image"},
+			Body:   regexp.MustCompile("违反相关政策"),
+			Action: ErrorActionSkip,
+		},
+		{
+			Name:        "unavailable",
+			StatusCodes: []int{503},
+			Action:      ErrorActionBanToken,
+		},
+	}))
+	require.Equal(t, ErrorActionSkip, ClassifyError("tuzi", "gpt-4o-image", 200, "图片检测系统认为内容可能违反相关政策").Action)
+	require.Nil(t, ClassifyError("tuzi", "gpt-4o-image-vip", 200, "图片检测系统认为内容可能违反相关政策"))
+	require.Equal(t, "unavailable", ClassifyError("geek", "gpt-image-1", 503, "").Name)
+	require.Equal(t, "gpt_image_1_prompt", ClassifyError("geek", "gpt-image-1", 400,
+		"Your request may contain content that is not allowed by our safety system. Please try change the prompt and image.").Name)
+}
+
+func TestValidJSONPath(t *testing.T) {
+	require.NoError(t, ValidJSONPath("error.code"))
+	require.NoError(t, ValidJSONPath("$.errors[0][1].message"))
+	require.Error(t, ValidJSONPath("$"))
+	require.Error(t, ValidJSONPath("errors[x]"))
+	require.Error(t, ValidJSONPath("errors[0"))
+}
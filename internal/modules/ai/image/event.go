@@ -0,0 +1,62 @@
+package image
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+)
+
+// Attempt 单次供应商调用，调用前 Finished 为 false，调用结束后带上结果再通知一次
+type Attempt struct {
+	TaskID     int    `json:"task_id"`
+	Supplier   string `json:"supplier"`
+	TokenDesc  string `json:"token_desc"`
+	Model      string `json:"model"`
+	Finished   bool   `json:"finished"`
+	Succeed    bool   `json:"succeed"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func AttemptStarted(taskID int, token *ai.TokenWithModel) *Attempt {
+	return &Attempt{
+		TaskID:    taskID,
+		Supplier:  token.Supplier.String(),
+		TokenDesc: token.Desc,
+		Model:     token.Model,
+	}
+}
+
+func AttemptFinished(taskID int, token *ai.TokenWithModel, response Response, err error) *Attempt {
+	a := AttemptStarted(taskID, token)
+	a.Finished = true
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	a.Succeed = response.Succeed()
+	a.StatusCode = response.GetStatusCode()
+	if response.GetError() != nil {
+		a.Error = response.GetError().Error()
+	}
+	return a
+}
+
+type Progress struct {
+	TaskID   int     `json:"task_id"`
+	Progress float32 `json:"progress"` // 0 ~ 100
+}
+
+// ParseProgress 解析供应商返回的进度，如 "45%"、"45"
+func ParseProgress(s string) (float32, bool) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil || v < 0 || v > 100 {
+		return 0, false
+	}
+	return float32(v), true
+}
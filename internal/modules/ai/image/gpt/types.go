@@ -70,12 +70,20 @@ type Image1Request struct {
 	Prompt     string   `json:"prompt"`
 	Quality    string   `json:"quality"`
 	Size       string   `json:"size"`
+	Model      string   `json:"model"`
+}
+
+func (g *Image1Request) model() string {
+	if g.Model == "" {
+		return consts.GPTImage1.String()
+	}
+	return g.Model
 }
 
 func (g *Image1Request) BodyContentType(supplier consts.ModelSupplier) (io.Reader, string, error) {
 	if supplier == consts.Geek {
 		body := map[string]interface{}{}
-		body["model"] = "gpt-image-1"
+		body["model"] = g.model()
 		body["n"] = 1
 		body["prompt"] = g.Prompt
 		var images []string
@@ -126,7 +134,7 @@ func (g *Image1Request) BodyContentType(supplier consts.ModelSupplier) (io.Reade
 			}
 		}
 		_ = writer.WriteField("prompt", g.Prompt)
-		_ = writer.WriteField("model", "gpt-image-1")
+		_ = writer.WriteField("model", g.model())
 		if g.Quality != "" {
 			_ = writer.WriteField("quality", g.Quality)
 		}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+)
+
+var CancelledError = errors.New("并行请求中已有其他 token 成功，本次请求被取消")
+
+// NewCancelledResponse 被取消的并行请求，仅用于记录调用历史
+func NewCancelledResponse(taskID int, token *ai.TokenWithModel, startAt, endAt time.Time) Response {
+	return &BaseResponse{
+		Supplier:  token.Supplier.String(),
+		TokenDesc: token.Desc,
+		Model:     token.Model,
+		StartAt:   startAt,
+		EndAt:     endAt,
+		ReqAt:     startAt,
+		RespAt:    endAt,
+		Error:     CancelledError,
+		TaskID:    taskID,
+		Price:     token.Price,
+	}
+}
+
+// Hedge 同时用多个 token 发起同一请求，第一个成功的结果返回后取消其余请求。
+// 返回值按 tokens 顺序排列：出错的请求不返回，被取消的请求以 CancelledError 标记
+func Hedge(ctx context.Context, taskID int, tokens []*ai.TokenWithModel,
+	do func(ctx context.Context, token *ai.TokenWithModel) (Response, error)) []Response {
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		index    int
+		response Response
+		err      error
+		endAt    time.Time
+	}
+	startAt := time.Now()
+	results := make(chan result, len(tokens))
+	for i, token := range tokens {
+		go func() {
+			response, err := do(hedgeCtx, token)
+			results <- result{index: i, response: response, err: err, endAt: time.Now()}
+		}()
+	}
+	ret := make([]Response, len(tokens))
+	winner := -1
+	for range tokens {
+		r := <-results
+		switch {
+		case winner == -1 && r.err == nil && r.response.Succeed():
+			winner = r.index
+			ret[r.index] = r.response
+			cancel()
+		case winner != -1 && ctx.Err() == nil && (r.err != nil || r.response.Succeed()):
+			// 被取消，或在取消前成功但结果已不再需要
+			ret[r.index] = NewCancelledResponse(taskID, tokens[r.index], startAt, r.endAt)
+		case r.err == nil:
+			ret[r.index] = r.response
+		}
+	}
+	responses := make([]Response, 0, len(tokens))
+	for _, v := range ret {
+		if v != nil {
+			responses = append(responses, v)
+		}
+	}
+	return responses
+}
@@ -0,0 +1,49 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedge(t *testing.T) {
+	tokens := []*ai.TokenWithModel{
+		{Token: ai.Token{Desc: "slow", Supplier: consts.Tuzi}},
+		{Token: ai.Token{Desc: "fast", Supplier: consts.Geek}},
+		{Token: ai.Token{Desc: "broken", Supplier: consts.V3}},
+	}
+	responses := Hedge(context.Background(), 1, tokens, func(ctx context.Context, token *ai.TokenWithModel) (Response, error) {
+		switch token.Desc {
+		case "fast":
+			time.Sleep(10 * time.Millisecond)
+			return &BaseResponse{Supplier: token.Supplier.String(), URLs: []string{"https://example.com/1.png"}}, nil
+		case "broken":
+			return nil, errors.New("connection refused")
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	require.Len(t, responses, 2)
+	require.ErrorIs(t, responses[0].GetError(), CancelledError)
+	require.Equal(t, consts.Tuzi.String(), responses[0].GetSupplier())
+	require.True(t, responses[1].Succeed())
+}
+
+func TestHedgeAllFailed(t *testing.T) {
+	tokens := []*ai.TokenWithModel{
+		{Token: ai.Token{Desc: "a", Supplier: consts.Tuzi}},
+		{Token: ai.Token{Desc: "b", Supplier: consts.Geek}},
+	}
+	responses := Hedge(context.Background(), 1, tokens, func(ctx context.Context, token *ai.TokenWithModel) (Response, error) {
+		return &BaseResponse{StatusCode: 500, Error: StatusCodeError}, nil
+	})
+	require.Len(t, responses, 2)
+	for _, v := range responses {
+		require.ErrorIs(t, v.GetError(), StatusCodeError)
+	}
+}
@@ -3,98 +3,31 @@ package mj
 import (
 	"context"
 	"encoding/base64"
-	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
 	"github.com/reusedev/draw-hub/internal/consts"
 	"github.com/reusedev/draw-hub/internal/modules/ai"
 	"github.com/reusedev/draw-hub/internal/modules/ai/image"
-	"github.com/reusedev/draw-hub/internal/modules/logs"
-	"github.com/reusedev/draw-hub/internal/modules/observer"
-	"strconv"
-	"sync"
-	"time"
 )
 
-type Provider struct {
-	Ctx       context.Context
-	Observers []observer.Observer
+func init() {
+	image.Register(consts.ProviderMidjourney, Provider{})
 }
 
-func NewProvider(ctx context.Context, observers []observer.Observer) *Provider {
-	return &Provider{
-		Ctx:       ctx,
-		Observers: observers,
-	}
-}
+type Provider struct{}
 
-func (p *Provider) Notify(event int, data interface{}) {
-	for _, o := range p.Observers {
-		o.Update(event, data)
+func (p Provider) Do(ctx context.Context, token *ai.TokenWithModel, input image.Input, notify image.Notify) (image.Response, error) {
+	// 参考图以 --sref 传入
+	if len(input.ImageURLs) != 0 && !strings.Contains(input.Prompt, "--sref") {
+		input.Prompt = strings.TrimSpace(input.Prompt) + fmt.Sprintf(" --sref %s", strings.Join(input.ImageURLs, " "))
 	}
+	return p.create(ctx, input, token, notify)
 }
 
-type Request struct {
-	ImageURLs  []string `json:"image_urls"`
-	ImageBytes [][]byte `json:"image_bytes"`
-	Prompt     string   `json:"prompt"`
-	TaskID     int      `json:"task_id"`
-}
-
-func (p *Provider) Create(request Request) {
-	var once sync.Once
-	down := make(chan struct{})
-	defer func() { down <- struct{}{} }()
-	go func() {
-		select {
-		case <-p.Ctx.Done():
-			once.Do(func() {
-				p.Notify(consts.EventSysExit, &image.GenericSysExitResponse{
-					TaskID: request.TaskID,
-				})
-			})
-			return
-		case <-down:
-			return
-		}
-	}()
-	ret := make([]image.Response, 0)
-	getToken := ai.GTokenManager[consts.MidJourney.String()].GetTokenIterator()
-	for {
-		token := getToken()
-		if token == nil {
-			break
-		}
-		logs.Logger.Info().Int("task_id", request.TaskID).Str("supplier", token.Supplier.String()).
-			Str("token_desc", token.Desc).Str("model", token.Model).Msg("Attempting Midjourney Create request")
-		response, err := p.create(request, token)
-		if err != nil {
-			logs.Logger.Error().Err(err).Int("task_id", request.TaskID).Str("supplier", token.Supplier.String()).
-				Str("model", token.Model).Msg("Midjourney Create request failed")
-			continue
-		}
-		ret = append(ret, response)
-		if response.Succeed() {
-			urls := response.GetURLs()
-			logs.Logger.Info().Int("task_id", request.TaskID).Str("supplier", token.Supplier.String()).
-				Str("model", token.Model).Strs("image_urls", urls).
-				Msg("Midjourney Create request succeeded, stopping iteration")
-			break
-		}
-		logs.Logger.Warn().Int("task_id", request.TaskID).Str("supplier", token.Supplier.String()).
-			Str("model", token.Model).Msg("Midjourney Create request completed but failed validation, continuing")
-		if response.GetError() != nil {
-			if errors.Is(response.GetError(), image.PromptError) {
-				break
-			}
-		}
-		if image.ShouldBanToken(response) {
-			ai.GTokenManager[consts.MidJourney.String()].Ban(token.Supplier, time.Now().Add(10*time.Minute))
-		}
-	}
-	once.Do(func() { p.Notify(consts.EventTaskEnd, ret) })
-}
-
-func (p *Provider) create(request Request, token *ai.TokenWithModel) (image.Response, error) {
+func (p Provider) create(ctx context.Context, request image.Input, token *ai.TokenWithModel, notify image.Notify) (image.Response, error) {
 	if token.Supplier == consts.Tuzi {
 		b64s := make([]string, 0)
 		if len(request.ImageBytes) != 0 {
@@ -118,7 +51,8 @@ func (p *Provider) create(request Request, token *ai.TokenWithModel) (image.Resp
 			},
 		)
 		requester.SetTaskID(request.TaskID)
-		return requester.Do()
+		requester.SetOnPolling(reportProgress(request.TaskID, notify))
+		return requester.Do(ctx)
 	} else if token.Supplier == consts.Geek {
 		reqType := geekGenerateRequest{
 			Prompt: request.Prompt,
@@ -129,7 +63,7 @@ func (p *Provider) create(request Request, token *ai.TokenWithModel) (image.Resp
 			&reqType,
 			parser{&geekGenerateURLStrategy{}},
 		)
-		return requester.Do()
+		return requester.Do(ctx)
 	} else if token.Supplier == consts.V3 {
 		b64s := make([]string, 0)
 		if len(request.ImageBytes) != 0 {
@@ -152,7 +86,20 @@ func (p *Provider) create(request Request, token *ai.TokenWithModel) (image.Resp
 				pollingContent.ID = strconv.FormatInt(response.GetProviderTaskID(), 10)
 			},
 		)
-		return requester.Do()
+		requester.SetTaskID(request.TaskID)
+		requester.SetOnPolling(reportProgress(request.TaskID, notify))
+		return requester.Do(ctx)
 	}
 	return nil, fmt.Errorf("not support supplier: %s", token.Supplier)
 }
+
+// reportProgress 轮询结果中的 progress 字段，如 "45%"
+func reportProgress(taskID int, notify image.Notify) func(response image.Response) {
+	return func(response image.Response) {
+		progress, ok := image.ParseProgress(jsoniter.Get([]byte(response.GetRespBody()), "progress").ToString())
+		if !ok {
+			return
+		}
+		notify(consts.EventProgress, &image.Progress{TaskID: taskID, Progress: progress})
+	}
+}
@@ -124,7 +124,7 @@ func (p parser) Parse(resp *http.Response, response image.Response) error {
 			return err
 		}
 		response.SetBasicResponse(resp.StatusCode, string(data))
-		response.SetError(image.StatusCodeError)
+		response.SetError(image.DetectError(response, string(data)))
 		return nil
 	}
 	body, err := io.ReadAll(resp.Body)
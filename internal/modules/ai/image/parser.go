@@ -4,13 +4,14 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
-	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
 	"github.com/reusedev/draw-hub/internal/modules/logs"
 )
 
@@ -268,50 +269,49 @@ func (s *StreamParser) Parse(resp *http.Response, response Response) error {
 }
 
 var (
-	PromptError     = errors.New("图片检测系统认为内容可能违反相关政策")
-	NoImageError    = errors.New("未提取到图片")
-	StatusCodeError = errors.New("http状态码非200")
+	PromptError              = errors.New("图片检测系统认为内容可能违反相关政策")
+	NoImageError             = errors.New("未提取到图片")
+	StatusCodeError          = errors.New("http状态码非200")
+	TokenRejectedError       = errors.New("供应商拒绝了当前 token")
+	RetryableError           = errors.New("供应商返回可重试的错误")
+	InsufficientBalanceError = errors.New("供应商余额不足")
+	SkippedError             = errors.New("供应商返回可忽略的错误")
+	RateLimitedError         = errors.New("供应商限流")
 )
 
-var (
-	errorMap = map[string]map[string]error{
-		consts.Tuzi.String() + consts.GPT4oImage.String(): {
-			"图片检测系统认为内容可能违反相关政策": PromptError,
-		},
-		consts.Tuzi.String() + consts.GPT4oImageVip.String(): {
-			"图片检测系统认为内容可能违反相关政策": PromptError,
-		},
-		consts.Geek.String() + consts.GPT4oImage.String(): {
-			"图片检测系统认为内容可能违反相关政策": PromptError,
-		},
-		consts.V3.String() + consts.GPT4oImageVip.String(): {
-			"输入的提示词或视频的输出内容违反了OpenAI的相关服务政策，请调整提示词后进行重试": PromptError,
-		},
-		consts.Geek.String() + consts.GPTImage1.String(): {
-			"Your request may contain content that is not allowed by our safety system. Please try change the prompt and image.": PromptError,
-		},
-		consts.Tuzi.String() + consts.TuziGemini3.String(): {
-			"your request has been blocked by Google Gemini (PROHIBITED_CONTENT): content is prohibited under official usage policies.": PromptError,
-		},
-		consts.Tuzi.String() + consts.TuziGemini32k.String(): {
-			"your request has been blocked by Google Gemini (PROHIBITED_CONTENT): content is prohibited under official usage policies.": PromptError,
-		},
-		consts.Tuzi.String() + consts.TuziGemini34k.String(): {
-			"your request has been blocked by Google Gemini (PROHIBITED_CONTENT): content is prohibited under official usage policies.": PromptError,
-		},
+// RuleError 命中 error_rules 中的规则，errors.Is 可按规则动作判断
+type RuleError struct {
+	Rule *ai.ErrorRule
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("%s (rule %s)", e.Unwrap().Error(), e.Rule.Name)
+}
+
+func (e *RuleError) Unwrap() error {
+	switch e.Rule.Action {
+	case ai.ErrorActionPromptViolation:
+		return PromptError
+	case ai.ErrorActionBanToken:
+		return TokenRejectedError
+	case ai.ErrorActionRetry:
+		return RetryableError
+	case ai.ErrorActionInsufficientBalance:
+		return InsufficientBalanceError
+	default:
+		return SkippedError
 	}
-)
+}
 
 func DetectError(response Response, body string) error {
 	if response.Succeed() {
 		return nil
 	}
-	if errs, ok := errorMap[response.GetSupplier()+response.GetModel()]; ok {
-		for key, err := range errs {
-			if strings.Contains(body, key) {
-				return err
-			}
-		}
+	if rule := ai.ClassifyError(response.GetSupplier(), response.GetModel(), response.GetStatusCode(), body); rule != nil {
+		return &RuleError{Rule: rule}
+	}
+	if response.GetStatusCode() == http.StatusTooManyRequests {
+		return RateLimitedError
 	}
 	if response.GetStatusCode() != http.StatusOK {
 		return StatusCodeError
@@ -330,10 +330,47 @@ func (g *GenericSysExitResponse) GetTaskID() int {
 	return g.TaskID
 }
 
-func ShouldBanToken(response Response) bool {
-	c := response.GetStatusCode()
-	if c >= 500 && c < 600 {
-		return true
+// Interrupted 任务上下文已结束且没有成功结果时，应通知 EventSysExit 而不是 EventTaskEnd
+func Interrupted(ctx context.Context, responses []Response) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	for _, v := range responses {
+		if v.Succeed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Feedback 将一次请求的结果反馈给 token 的熔断器；任务被取消、违反内容政策或命中 skip 规则不计入，命中封禁规则时直接熔断，
+// 429 时短暂退避
+func Feedback(ctx context.Context, manager *ai.TokenManager, token *ai.TokenWithModel, response Response, err error) {
+	if ctx.Err() != nil || manager == nil {
+		return
+	}
+	manager = manager.Current()
+	if err != nil {
+		manager.Report(token.Token, false, 0)
+		return
+	}
+	if response.Succeed() {
+		manager.Report(token.Token, true, time.Duration(response.ReqConsumeMs())*time.Millisecond)
+		return
+	}
+	if errors.Is(response.GetError(), RateLimitedError) {
+		ai.Backoff(token.Key())
+		return
+	}
+	var ruleErr *RuleError
+	if errors.As(response.GetError(), &ruleErr) {
+		switch ruleErr.Rule.Action {
+		case ai.ErrorActionPromptViolation, ai.ErrorActionSkip:
+			return
+		case ai.ErrorActionBanToken, ai.ErrorActionInsufficientBalance:
+			manager.Ban(token.Token, time.Now().Add(ruleErr.Rule.BanDuration()))
+			return
+		}
 	}
-	return false
+	manager.Report(token.Token, false, 0)
 }
@@ -0,0 +1,140 @@
+package image
+
+import (
+	"context"
+	"errors"
+
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/observer"
+)
+
+// Input 一次图片任务的参数，各供应商接口按需使用
+type Input struct {
+	TaskID     int
+	Model      string // request_order 中的模型分类
+	Prompt     string
+	ImageBytes [][]byte
+	ImageURLs  []string
+	Quality    string
+	Size       string
+}
+
+type Notify func(event int, data interface{})
+
+// Provider 一种供应商接口，使用给定的 token 发起一次请求；token 的选择、重试和熔断由 Executor 负责
+type Provider interface {
+	Do(ctx context.Context, token *ai.TokenWithModel, input Input, notify Notify) (Response, error)
+}
+
+var providers = make(map[consts.ProviderKind]Provider)
+
+// Register 在供应商包的 init 中调用
+func Register(kind consts.ProviderKind, provider Provider) {
+	providers[kind] = provider
+}
+
+// GetProvider 未注册时返回 nil
+func GetProvider(kind consts.ProviderKind) Provider {
+	return providers[kind]
+}
+
+type Executor struct {
+	Ctx          context.Context
+	Observers    []observer.Observer
+	TokenOptions []ai.IteratorOption
+}
+
+func NewExecutor(ctx context.Context, observers []observer.Observer, tokenOptions ...ai.IteratorOption) *Executor {
+	return &Executor{
+		Ctx:          ctx,
+		Observers:    observers,
+		TokenOptions: tokenOptions,
+	}
+}
+
+func (e *Executor) Notify(event int, data interface{}) {
+	for _, o := range e.Observers {
+		o.Update(event, data)
+	}
+}
+
+// Run 按 token 顺序依次尝试，直到成功或提示词违规；配置了 hedge 的模型每批并行请求多个 token。
+// 结束时通知 EventTaskEnd，任务上下文结束且没有成功结果时通知 EventSysExit
+func (e *Executor) Run(provider Provider, input Input) {
+	ret := make([]Response, 0)
+	manager := ai.GetTokenManager(input.Model)
+	getTokens := manager.GetTokenBatchIterator(manager.Hedge(), append(e.TokenOptions, ai.WithContext(e.Ctx))...)
+	for {
+		if e.Ctx.Err() != nil {
+			break
+		}
+		tokens := getTokens()
+		if len(tokens) == 0 {
+			break
+		}
+		var responses []Response
+		if len(tokens) == 1 {
+			response, err := e.attempt(e.Ctx, manager, provider, tokens[0], input)
+			if err == nil {
+				responses = append(responses, response)
+			}
+		} else {
+			responses = Hedge(e.Ctx, input.TaskID, tokens, func(ctx context.Context, token *ai.TokenWithModel) (Response, error) {
+				return e.attempt(ctx, manager, provider, token, input)
+			})
+		}
+		ret = append(ret, responses...)
+		if stop(responses) {
+			break
+		}
+	}
+	// 上下文结束前已有成功结果时仍按正常结束处理，不丢弃已付费的结果
+	if Interrupted(e.Ctx, ret) {
+		e.Notify(consts.EventSysExit, &GenericSysExitResponse{
+			TaskID: input.TaskID,
+		})
+		return
+	}
+	e.Notify(consts.EventTaskEnd, ret)
+}
+
+func (e *Executor) attempt(ctx context.Context, manager *ai.TokenManager, provider Provider, token *ai.TokenWithModel, input Input) (Response, error) {
+	logs.Logger.Info().Int("task_id", input.TaskID).Str("supplier", token.Supplier.String()).
+		Str("token_desc", token.Desc).Str("model", token.Model).Msg("Attempting image request")
+	e.Notify(consts.EventAttempt, AttemptStarted(input.TaskID, token))
+	response, err := provider.Do(ctx, token, input, e.Notify)
+	if err == nil {
+		response.SetPrice(token.Price)
+		if ai.GBudget != nil {
+			ai.GBudget.Consume(*token)
+		}
+	}
+	e.Notify(consts.EventAttempt, AttemptFinished(input.TaskID, token, response, err))
+	Feedback(ctx, manager, token, response, err)
+	if err != nil {
+		logs.Logger.Error().Err(err).Int("task_id", input.TaskID).Str("supplier", token.Supplier.String()).
+			Str("token_desc", token.Desc).Str("model", token.Model).Msg("Image request failed")
+		return nil, err
+	}
+	if response.Succeed() {
+		logs.Logger.Info().Int("task_id", input.TaskID).Str("supplier", token.Supplier.String()).
+			Str("model", token.Model).Strs("image_urls", response.GetURLs()).
+			Msg("Image request succeeded, stopping iteration")
+	} else {
+		logs.Logger.Warn().Int("task_id", input.TaskID).Str("supplier", token.Supplier.String()).
+			Str("model", token.Model).Msg("Image request completed but failed validation, continuing")
+	}
+	return response, nil
+}
+
+// stop 有成功结果或提示词违规时不再尝试其他 token
+func stop(responses []Response) bool {
+	for _, v := range responses {
+		if v.Succeed() || errors.Is(v.GetError(), PromptError) {
+			return true
+		}
+	}
+	return false
+}
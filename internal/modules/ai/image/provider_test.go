@@ -0,0 +1,126 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/observer"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	lock   sync.Mutex
+	calls  []string
+	cancel context.CancelFunc // 成功返回时结束任务上下文
+}
+
+func (p *fakeProvider) Do(ctx context.Context, token *ai.TokenWithModel, input Input, notify Notify) (Response, error) {
+	p.lock.Lock()
+	p.calls = append(p.calls, token.Desc)
+	p.lock.Unlock()
+	if token.Desc == "slow" {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if token.Desc == "broken" {
+		return nil, errors.New("connection refused")
+	}
+	if p.cancel != nil {
+		p.cancel()
+	}
+	return &BaseResponse{Supplier: token.Supplier.String(), TokenDesc: token.Desc, URLs: []string{"https://example.com/" + input.Prompt}}, nil
+}
+
+type recorder struct {
+	lock   sync.Mutex
+	events []int
+	end    []Response
+}
+
+func (r *recorder) Update(event int, data interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+	if event == consts.EventTaskEnd {
+		r.end = data.([]Response)
+	}
+}
+
+type fakeBudget struct {
+	consumed []string
+}
+
+func (b *fakeBudget) Allow(token ai.TokenWithModel) bool { return true }
+
+func (b *fakeBudget) Consume(token ai.TokenWithModel) {
+	b.consumed = append(b.consumed, token.Desc)
+}
+
+func TestExecutor(t *testing.T) {
+	broken := ai.TokenWithModel{Token: ai.Token{Token: "sk-1", Desc: "broken", Supplier: consts.Tuzi}, Model: "fake"}
+	ok := ai.TokenWithModel{Token: ai.Token{Token: "sk-2", Desc: "ok", Supplier: consts.Geek}, Model: "fake", Price: 0.04}
+	unused := ai.TokenWithModel{Token: ai.Token{Token: "sk-3", Desc: "unused", Supplier: consts.V3}, Model: "fake"}
+	require.NoError(t, ai.ReloadTokenManager([]string{"fake"}, [][][]ai.TokenWithModel{{{broken}, {ok}, {unused}}}))
+
+	Register("fake", &fakeProvider{})
+	defer delete(providers, "fake")
+	provider := GetProvider("fake").(*fakeProvider)
+	require.Nil(t, GetProvider("unknown"))
+
+	budget := &fakeBudget{}
+	ai.GBudget = budget
+	defer func() { ai.GBudget = nil }()
+
+	r := &recorder{}
+	NewExecutor(context.Background(), []observer.Observer{r}).Run(provider, Input{TaskID: 1, Model: "fake", Prompt: "1.png"})
+
+	// 出错的 token 不计入结果，成功后不再尝试后续 token
+	require.Equal(t, []string{"broken", "ok"}, provider.calls)
+	require.Len(t, r.end, 1)
+	require.True(t, r.end[0].Succeed())
+	require.Equal(t, "ok", r.end[0].GetTokenDesc())
+	require.Equal(t, 0.04, r.end[0].GetPrice())
+	// 只有返回结果的请求计入预算
+	require.Equal(t, []string{"ok"}, budget.consumed)
+	require.Equal(t, []int{consts.EventAttempt, consts.EventAttempt, consts.EventAttempt, consts.EventAttempt, consts.EventTaskEnd}, r.events)
+}
+
+func TestExecutorCancel(t *testing.T) {
+	slow := ai.TokenWithModel{Token: ai.Token{Token: "sk-1", Desc: "slow", Supplier: consts.Tuzi}, Model: "cancel"}
+	require.NoError(t, ai.ReloadTokenManager([]string{"cancel"}, [][][]ai.TokenWithModel{{{slow}}}))
+
+	r := &recorder{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		NewExecutor(ctx, []observer.Observer{r}).Run(&fakeProvider{}, Input{TaskID: 2, Model: "cancel", Prompt: "2.png"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after the task context ended")
+	}
+	require.Equal(t, consts.EventSysExit, r.events[len(r.events)-1])
+	require.NotContains(t, r.events, consts.EventTaskEnd)
+}
+
+func TestExecutorCancelAfterSuccess(t *testing.T) {
+	ok := ai.TokenWithModel{Token: ai.Token{Token: "sk-2", Desc: "ok", Supplier: consts.Geek}, Model: "cancel"}
+	require.NoError(t, ai.ReloadTokenManager([]string{"cancel"}, [][][]ai.TokenWithModel{{{ok}}}))
+
+	r := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	NewExecutor(ctx, []observer.Observer{r}).Run(&fakeProvider{cancel: cancel}, Input{TaskID: 3, Model: "cancel", Prompt: "3.png"})
+
+	// 成功后上下文才结束，结果不丢弃
+	require.NotContains(t, r.events, consts.EventSysExit)
+	require.Len(t, r.end, 1)
+	require.True(t, r.end[0].Succeed())
+}
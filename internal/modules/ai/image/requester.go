@@ -1,6 +1,8 @@
 package image
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/reusedev/draw-hub/internal/modules/ai"
 	"github.com/reusedev/draw-hub/internal/modules/http_client"
@@ -32,18 +34,21 @@ func (r *SyncRequester) SetTaskID(taskID int) *SyncRequester {
 	return r
 }
 
-func (r *SyncRequester) Do() (Response, error) {
+func (r *SyncRequester) Do(ctx context.Context) (Response, error) {
 	retryTimes := 0
+	ruleRetries := 0 // 命中 retry 规则的重试次数
 retry:
-	client := http_client.NewWithTimeout(10 * time.Minute)
+	supplier := ai.GetSupplier(r.token.Supplier)
+	client := &http_client.HttpClient{HttpClient: supplier.Client(10 * time.Minute)}
 	body, contentType, err := r.Request.BodyContentType(r.token.Supplier)
 	if err != nil {
 		return nil, err
 	}
 	req, err := client.NewRequest(
 		http.MethodPost,
-		tools.FullURL(r.token.GetSupplier().BaseURL(), r.Request.Path(r.token.Supplier)),
-		http_client.WithHeader("Authorization", "Bearer "+r.token.Token),
+		tools.FullURL(supplier.BaseURL(), r.Request.Path(r.token.Supplier)),
+		http_client.WithContext(ctx),
+		http_client.WithHeaders(supplier.Headers(r.token.Token)),
 		http_client.WithHeader("Content-Type", contentType),
 		http_client.WithBody(body),
 	)
@@ -55,7 +60,7 @@ retry:
 	respAt := time.Now()
 	if err != nil {
 		// tuzi 收到请求后，长时间未响应也未计费，导致任务一直running
-		if strings.Contains(err.Error(), "Client.Timeout") {
+		if ctx.Err() == nil && strings.Contains(err.Error(), "Client.Timeout") {
 			if retryTimes < 2 {
 				retryTimes++
 				goto retry
@@ -83,6 +88,19 @@ retry:
 	if err != nil {
 		return nil, err
 	}
+	var ruleErr *RuleError
+	if errors.As(ret.GetError(), &ruleErr) && ruleErr.Rule.Action == ai.ErrorActionRetry && ruleRetries < ruleErr.Rule.MaxRetries() {
+		ruleRetries++
+		logs.Logger.Warn().Int("task_id", r.TaskID).Str("supplier", r.token.Supplier.String()).
+			Str("token_desc", r.token.Desc).Str("rule", ruleErr.Rule.Name).Int("retry", ruleRetries).
+			Msg("Retrying image request with the same token")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+		goto retry
+	}
 	return ret, nil
 }
 
@@ -93,7 +111,8 @@ type AsyncRequester struct {
 	PollingRequest  Request[Response]
 	PollingParser   Parser[Response]
 	OnSubmitSucceed func(response SubmitResponse)
-	TaskID          int // 添加TaskID字段用于日志跟踪
+	OnPolling       func(response Response) // 每次轮询结束后调用，可用于上报进度
+	TaskID          int                     // 添加TaskID字段用于日志跟踪
 }
 
 func NewAsyncRequester(
@@ -116,8 +135,13 @@ func (r *AsyncRequester) SetTaskID(taskID int) *AsyncRequester {
 	return r
 }
 
-func (r *AsyncRequester) Do() (Response, error) {
-	submitRet, err := r.submit()
+func (r *AsyncRequester) SetOnPolling(onPolling func(response Response)) *AsyncRequester {
+	r.OnPolling = onPolling
+	return r
+}
+
+func (r *AsyncRequester) Do(ctx context.Context) (Response, error) {
+	submitRet, err := r.submit(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -126,34 +150,48 @@ func (r *AsyncRequester) Do() (Response, error) {
 	}
 	r.OnSubmitSucceed(submitRet)
 
+	ruleRetries := 0 // 命中 retry 规则的重试次数，任务已提交，只重新查询结果
 	for {
-		pollingRet, err := r.polling()
+		pollingRet, err := r.polling(ctx)
 		if err != nil {
 			return nil, err
 		}
+		if r.OnPolling != nil {
+			r.OnPolling(pollingRet)
+		}
+		var ruleErr *RuleError
 		if pollingRet.Succeed() {
 			pollingRet.SetStartAt(submitRet.GetReqAt())
 			pollingRet.SetEndAt(pollingRet.GetRespAt())
 			return pollingRet, nil
-		} else {
-			if pollingRet.GetError() != nil {
-				return pollingRet, nil
-			}
+		} else if errors.As(pollingRet.GetError(), &ruleErr) && ruleErr.Rule.Action == ai.ErrorActionRetry && ruleRetries < ruleErr.Rule.MaxRetries() {
+			ruleRetries++
+			logs.Logger.Warn().Int("task_id", r.TaskID).Str("supplier", r.token.Supplier.String()).
+				Str("token_desc", r.token.Desc).Str("rule", ruleErr.Rule.Name).Int("retry", ruleRetries).
+				Msg("Retrying polling request with the same token")
+		} else if pollingRet.GetError() != nil {
+			return pollingRet, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(3 * time.Second):
 		}
-		time.Sleep(3 * time.Second)
 	}
 }
 
-func (r *AsyncRequester) submit() (SubmitResponse, error) {
-	client := http_client.New()
+func (r *AsyncRequester) submit(ctx context.Context) (SubmitResponse, error) {
+	supplier := ai.GetSupplier(r.token.Supplier)
+	client := &http_client.HttpClient{HttpClient: supplier.Client(120 * time.Second)}
 	body, contentType, err := r.SubmitRequest.BodyContentType(r.token.Supplier)
 	if err != nil {
 		return nil, err
 	}
 	req, err := client.NewRequest(
 		http.MethodPost,
-		tools.FullURL(r.token.GetSupplier().BaseURL(), r.SubmitRequest.Path(r.token.Supplier)),
-		http_client.WithHeader("Authorization", "Bearer "+r.token.Token),
+		tools.FullURL(supplier.BaseURL(), r.SubmitRequest.Path(r.token.Supplier)),
+		http_client.WithContext(ctx),
+		http_client.WithHeaders(supplier.Headers(r.token.Token)),
 		http_client.WithHeader("Content-Type", contentType),
 		http_client.WithBody(body),
 	)
@@ -187,16 +225,18 @@ func (r *AsyncRequester) submit() (SubmitResponse, error) {
 	return ret, nil
 }
 
-func (r *AsyncRequester) polling() (Response, error) {
-	client := http_client.New()
+func (r *AsyncRequester) polling(ctx context.Context) (Response, error) {
+	supplier := ai.GetSupplier(r.token.Supplier)
+	client := &http_client.HttpClient{HttpClient: supplier.Client(120 * time.Second)}
 	_, contentType, err := r.PollingRequest.BodyContentType(r.token.Supplier)
 	if err != nil {
 		return nil, err
 	}
 	req, err := client.NewRequest(
 		http.MethodGet,
-		tools.FullURL(r.token.GetSupplier().BaseURL(), r.PollingRequest.Path(r.token.Supplier)),
-		http_client.WithHeader("Authorization", "Bearer "+r.token.Token),
+		tools.FullURL(supplier.BaseURL(), r.PollingRequest.Path(r.token.Supplier)),
+		http_client.WithContext(ctx),
+		http_client.WithHeaders(supplier.Headers(r.token.Token)),
 		http_client.WithHeader("Content-Type", contentType),
 	)
 	if err != nil {
@@ -31,6 +31,7 @@ type Response interface {
 	GetURLs() []string
 	GetB64s() []string
 	GetError() error // is nil if Succeed() return true
+	GetPrice() float64
 
 	SetBasicResponse(statusCode int, respBody string)
 	SetStartAt(startAt time.Time)
@@ -41,6 +42,7 @@ type Response interface {
 	SetB64s(b64 []string)
 	SetError(err error)
 	SetTaskID(taskID int)
+	SetPrice(price float64)
 }
 
 type SysExitResponse interface {
@@ -61,6 +63,7 @@ type BaseResponse struct {
 	B64s       []string  `json:"b64s"`
 	Error      error     `json:"error,omitempty"`
 	TaskID     int       `json:"task_id"`
+	Price      float64   `json:"price"` // 发起请求时 token 的单次价格
 }
 
 func (r *BaseResponse) GetSupplier() string  { return r.Supplier }
@@ -73,6 +76,7 @@ func (r *BaseResponse) GetTaskID() int       { return r.TaskID }
 func (r *BaseResponse) GetURLs() []string    { return r.URLs }
 func (r *BaseResponse) GetB64s() []string    { return r.B64s }
 func (r *BaseResponse) GetError() error      { return r.Error }
+func (r *BaseResponse) GetPrice() float64    { return r.Price }
 func (r *BaseResponse) Succeed() bool        { return len(r.URLs) != 0 || len(r.B64s) != 0 }
 func (r *BaseResponse) TaskConsumeMs() int64 { return r.EndAt.Sub(r.StartAt).Milliseconds() }
 func (r *BaseResponse) ReqConsumeMs() int64  { return r.RespAt.Sub(r.ReqAt).Milliseconds() }
@@ -89,3 +93,4 @@ func (r *BaseResponse) SetURLs(urls []string)        { r.URLs = urls }
 func (r *BaseResponse) SetB64s(b64 []string)         { r.B64s = b64 }
 func (r *BaseResponse) SetError(err error)           { r.Error = err }
 func (r *BaseResponse) SetTaskID(taskID int)         { r.TaskID = taskID }
+func (r *BaseResponse) SetPrice(price float64)       { r.Price = price }
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit 令牌桶限流，RPM 为 0 表示不限制
+type RateLimit struct {
+	RPM   int
+	Burst int // 桶容量，默认 1
+}
+
+type RateLimitConfig struct {
+	MaxWait time.Duration // 所有 token 都被限流时迭代器最多等待的时间，超过则返回 nil
+	Backoff time.Duration // 供应商返回 429 后暂停使用该 token 的时间
+}
+
+var DefaultRateLimitConfig = RateLimitConfig{
+	MaxWait: 3 * time.Second,
+	Backoff: 30 * time.Second,
+}
+
+type bucket struct {
+	limit        RateLimit
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.limit.RPM <= 0 {
+		return
+	}
+	if now.After(b.last) {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*float64(b.limit.RPM)/60, b.capacity())
+		b.last = now
+	}
+}
+
+func (b *bucket) capacity() float64 {
+	return float64(max(b.limit.Burst, 1))
+}
+
+// readyAt 可以发出下一个请求的时间，不晚于 now 表示可用
+func (b *bucket) readyAt(now time.Time) time.Time {
+	ready := now
+	if b.limit.RPM > 0 {
+		b.refill(now)
+		if b.tokens < 1 {
+			ready = now.Add(time.Duration((1 - b.tokens) * 60 / float64(b.limit.RPM) * float64(time.Second)))
+		}
+	}
+	if b.blockedUntil.After(ready) {
+		ready = b.blockedUntil
+	}
+	return ready
+}
+
+type rateLimiter struct {
+	lock    sync.Mutex
+	buckets map[TokenKey]*bucket
+	conf    RateLimitConfig
+}
+
+var gRateLimiter = &rateLimiter{buckets: make(map[TokenKey]*bucket), conf: DefaultRateLimitConfig}
+
+// SetRateLimits 更新各 token 的限流配置，配置不变的 token 保留当前桶内的令牌
+func SetRateLimits(limits map[TokenKey]RateLimit, conf RateLimitConfig) {
+	r := gRateLimiter
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	buckets := make(map[TokenKey]*bucket, len(limits))
+	for key, limit := range limits {
+		if limit.RPM <= 0 {
+			continue
+		}
+		if b, ok := r.buckets[key]; ok && b.limit == limit {
+			buckets[key] = b
+			continue
+		}
+		b := &bucket{limit: limit, last: now}
+		b.tokens = b.capacity()
+		buckets[key] = b
+	}
+	// 保留未结束的 429 退避
+	for key, b := range r.buckets {
+		if !b.blockedUntil.After(now) {
+			continue
+		}
+		if nb, ok := buckets[key]; ok {
+			nb.blockedUntil = b.blockedUntil
+		} else {
+			buckets[key] = &bucket{blockedUntil: b.blockedUntil}
+		}
+	}
+	r.buckets = buckets
+	r.conf = conf
+}
+
+// readyAt token 可以发出下一个请求的时间
+func (r *rateLimiter) readyAt(key TokenKey, now time.Time) time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.buckets[key]
+	if !ok {
+		return now
+	}
+	return b.readyAt(now)
+}
+
+func (r *rateLimiter) take(key TokenKey, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.buckets[key]
+	if !ok || b.limit.RPM <= 0 {
+		return
+	}
+	b.refill(now)
+	b.tokens--
+}
+
+func (r *rateLimiter) maxWait() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.conf.MaxWait
+}
+
+// Backoff 供应商返回 429 时调用，在退避时间内跳过该 token
+func Backoff(key TokenKey) {
+	r := gRateLimiter
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	b, ok := r.buckets[key]
+	if !ok {
+		b = &bucket{}
+		r.buckets[key] = b
+	}
+	b.blockedUntil = time.Now().Add(r.conf.Backoff)
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	tuzi := TokenWithModel{Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gpt-4o-image"}
+	geek := TokenWithModel{Token: Token{Token: "sk-2", Desc: "low_price", Supplier: consts.Geek}, Model: "gpt-4o-image"}
+	m := TokenManager{
+		Token:  [][]TokenWithModel{{tuzi}, {geek}},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	SetRateLimits(map[TokenKey]RateLimit{tuzi.Key(): {RPM: 600, Burst: 1}}, RateLimitConfig{MaxWait: time.Second, Backoff: time.Hour})
+	defer func() {
+		gRateLimiter = &rateLimiter{buckets: make(map[TokenKey]*bucket), conf: DefaultRateLimitConfig}
+	}()
+
+	require.Equal(t, "sk-1", m.GetTokenIterator()().Token.Token)
+	// 桶内没有令牌时跳到下一个 token
+	require.Equal(t, "sk-2", m.GetTokenIterator()().Token.Token)
+
+	// 只剩被限流的 token 时等待令牌恢复（600 RPM 即每 100ms 一个）
+	start := time.Now()
+	token := m.GetTokenIterator(WithSupplier(consts.Tuzi))()
+	require.Equal(t, "sk-1", token.Token.Token)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// 任务已取消时不等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	require.Nil(t, m.GetTokenIterator(WithSupplier(consts.Tuzi), WithContext(ctx))())
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// 429 退避时间超过 MaxWait，不等待
+	Backoff(tuzi.Key())
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	start = time.Now()
+	require.Nil(t, getToken())
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// 重新加载配置时保留退避
+	SetRateLimits(nil, RateLimitConfig{MaxWait: 0, Backoff: time.Hour})
+	require.Equal(t, "sk-2", m.GetTokenIterator()().Token.Token)
+}
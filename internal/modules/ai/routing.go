@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Prefer 忽略分组顺序时的选择偏好
+type Prefer string
+
+const (
+	PreferCheapest Prefer = "cheapest" // 价格最低，未配置价格的 token 排在最后
+	PreferFastest  Prefer = "fastest"  // 按成功率折算的期望耗时最小，见 TokenManager.latency
+)
+
+func (p Prefer) Valid() error {
+	switch p {
+	case "", PreferCheapest, PreferFastest:
+		return nil
+	}
+	return fmt.Errorf("unknown prefer: %s", p)
+}
+
+// RoutingStrategy 同一分组内 token 的选择策略
+type RoutingStrategy string
+
+const (
+	RoutingOrdered         RoutingStrategy = "ordered"           // 按声明顺序
+	RoutingRoundRobin      RoutingStrategy = "round_robin"       // 轮询
+	RoutingWeighted        RoutingStrategy = "weighted"          // 按权重随机
+	RoutingLeastLatency    RoutingStrategy = "least_latency"     // 按成功率折算的期望耗时最小
+	RoutingBestSuccessRate RoutingStrategy = "best_success_rate" // 成功率的 EWMA 最高
+)
+
+func (s RoutingStrategy) Valid() error {
+	switch s {
+	case RoutingOrdered, RoutingRoundRobin, RoutingWeighted, RoutingLeastLatency, RoutingBestSuccessRate:
+		return nil
+	}
+	return fmt.Errorf("unknown routing strategy: %s", s)
+}
+
+// ewmaAlpha 新样本的权重，约 10 次请求后旧数据的影响降到 10% 左右
+const ewmaAlpha = 0.2
+
+// tokenStats 单个 token 的 EWMA 统计，由 TokenManager 加锁访问
+type tokenStats struct {
+	samples     int
+	latencyMs   float64 // 只统计成功请求
+	successRate float64
+}
+
+func (s *tokenStats) record(success bool, latency time.Duration) {
+	v := 0.0
+	if success {
+		v = 1
+	}
+	if s.samples == 0 {
+		s.successRate = v
+	} else {
+		s.successRate = ewmaAlpha*v + (1-ewmaAlpha)*s.successRate
+	}
+	s.samples++
+	if success && latency > 0 {
+		ms := float64(latency.Milliseconds())
+		if s.latencyMs == 0 {
+			s.latencyMs = ms
+		} else {
+			s.latencyMs = ewmaAlpha*ms + (1-ewmaAlpha)*s.latencyMs
+		}
+	}
+}
+
+// pick 从分组 i 的候选下标中按策略选出一个，需持有 t.Lock
+func (t *TokenManager) pick(i int, candidates []int) int {
+	group := t.Token[i]
+	switch t.strategy(i) {
+	case RoutingRoundRobin:
+		if t.cursor == nil {
+			t.cursor = make(map[int]int)
+		}
+		start := t.cursor[i] % len(group)
+		t.cursor[i]++
+		best := candidates[0]
+		for _, j := range candidates {
+			// 取从 start 开始循环遇到的第一个候选
+			if (j-start+len(group))%len(group) < (best-start+len(group))%len(group) {
+				best = j
+			}
+		}
+		return best
+	case RoutingWeighted:
+		total := 0
+		for _, j := range candidates {
+			total += group[j].weight()
+		}
+		n := rand.IntN(total)
+		for _, j := range candidates {
+			n -= group[j].weight()
+			if n < 0 {
+				return j
+			}
+		}
+	case RoutingLeastLatency:
+		best := candidates[0]
+		for _, j := range candidates[1:] {
+			if t.latency(group[j].Token) < t.latency(group[best].Token) {
+				best = j
+			}
+		}
+		return best
+	case RoutingBestSuccessRate:
+		best := candidates[0]
+		for _, j := range candidates[1:] {
+			if t.successRate(group[j].Token) > t.successRate(group[best].Token) {
+				best = j
+			}
+		}
+		return best
+	}
+	return candidates[0]
+}
+
+func (t *TokenManager) strategy(i int) RoutingStrategy {
+	if i < len(t.strategies) && t.strategies[i] != "" {
+		return t.strategies[i]
+	}
+	return RoutingOrdered
+}
+
+// latency 成功请求耗时的 EWMA 除以成功率，失败越多期望耗时越长；没有请求记录的 token 视为 0，优先试探，
+// 有请求记录但从未成功的 token 视为无穷大，排在最后
+func (t *TokenManager) latency(token Token) float64 {
+	s := t.stats(token)
+	if s.samples == 0 {
+		return 0
+	}
+	if s.latencyMs == 0 || s.successRate <= 0 {
+		return math.Inf(1)
+	}
+	return s.latencyMs / s.successRate
+}
+
+// successRate 没有请求记录的 token 视为 1，优先试探
+func (t *TokenManager) successRate(token Token) float64 {
+	s := t.stats(token)
+	if s.samples == 0 {
+		return 1
+	}
+	return s.successRate
+}
+
+func (t *TokenManager) stats(token Token) *tokenStats {
+	if t.statistics == nil {
+		t.statistics = make(map[TokenKey]*tokenStats)
+	}
+	s, ok := t.statistics[token.Key()]
+	if !ok {
+		s = &tokenStats{}
+		t.statistics[token.Key()] = s
+	}
+	return s
+}
+
+// getPreferredTokens 在所有分组中按偏好取最多 n 个 token，需持有 t.Lock
+func (t *TokenManager) getPreferredTokens(client *Client, options *iteratorOptions, n int, now time.Time) []*TokenWithModel {
+	ret := make([]*TokenWithModel, 0, n)
+	for len(ret) < n {
+		bi, bj := -1, -1
+		for i, tokens := range t.Token {
+			for j := range tokens {
+				if !t.usable(client, options, i, j, now) {
+					continue
+				}
+				if bi == -1 || t.better(options.prefer, tokens[j], t.Token[bi][bj]) {
+					bi, bj = i, j
+				}
+			}
+		}
+		if bi == -1 {
+			break
+		}
+		ret = append(ret, t.take(client, bi, bj, now))
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// better a 是否优于 b，相同时保持声明顺序
+func (t *TokenManager) better(prefer Prefer, a, b TokenWithModel) bool {
+	switch prefer {
+	case PreferCheapest:
+		if a.Price == 0 || b.Price == 0 {
+			return a.Price != 0 && b.Price == 0
+		}
+		return a.Price < b.Price
+	case PreferFastest:
+		return t.latency(a.Token) < t.latency(b.Token)
+	}
+	return false
+}
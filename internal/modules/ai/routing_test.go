@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newRoutingManager(strategy RoutingStrategy) *TokenManager {
+	return &TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-2", Desc: "default", Supplier: consts.Geek}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-3", Desc: "default", Supplier: consts.V3}, Model: "gpt-4o-image"},
+			},
+		},
+		Lock:       &sync.Mutex{},
+		Client:     make([]*Client, 0),
+		strategies: []RoutingStrategy{strategy},
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	m := newRoutingManager(RoutingRoundRobin)
+	var first []string
+	for i := 0; i < 4; i++ {
+		first = append(first, m.GetTokenIterator()().Token.Token)
+	}
+	require.Equal(t, []string{"sk-1", "sk-2", "sk-3", "sk-1"}, first)
+
+	// 同一个迭代器仍会遍历分组内的全部 token
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+	require.Nil(t, getToken())
+}
+
+func TestLeastLatency(t *testing.T) {
+	m := newRoutingManager(RoutingLeastLatency)
+	m.Report(Token{Desc: "default", Supplier: consts.Tuzi}, true, 3*time.Second)
+	m.Report(Token{Desc: "default", Supplier: consts.Geek}, true, time.Second)
+	m.Report(Token{Desc: "default", Supplier: consts.V3}, true, 2*time.Second)
+
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+}
+
+func TestLeastLatencyWithFailures(t *testing.T) {
+	m := newRoutingManager(RoutingLeastLatency)
+	// sk-1 始终失败，没有耗时记录
+	m.Report(Token{Desc: "default", Supplier: consts.Tuzi}, false, 0)
+	m.Report(Token{Desc: "default", Supplier: consts.Tuzi}, false, 0)
+	m.Report(Token{Desc: "default", Supplier: consts.Geek}, true, 2*time.Second)
+	// sk-3 成功时更快，但失败后成功率降为 0.8，期望耗时为 2.25s
+	m.Report(Token{Desc: "default", Supplier: consts.V3}, true, 1800*time.Millisecond)
+	m.Report(Token{Desc: "default", Supplier: consts.V3}, false, 0)
+
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+
+	m.strategies = nil
+	getToken = m.GetTokenIterator(WithPrefer(PreferFastest))
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+}
+
+func TestBestSuccessRate(t *testing.T) {
+	m := newRoutingManager(RoutingBestSuccessRate)
+	m.Report(Token{Desc: "default", Supplier: consts.Tuzi}, false, 0)
+	m.Report(Token{Desc: "default", Supplier: consts.Geek}, true, time.Second)
+	m.Report(Token{Desc: "default", Supplier: consts.Geek}, false, 0)
+
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+}
+
+func TestWeighted(t *testing.T) {
+	m := newRoutingManager(RoutingWeighted)
+	m.Token[0][0].Weight = 1 << 30
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "sk-1", m.GetTokenIterator()().Token.Token)
+	}
+}
+
+func TestPreferCheapest(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Supplier: consts.Tuzi}, Model: "gpt-4o-image", Price: 0.08},
+			},
+			{
+				{Token: Token{Token: "sk-2", Supplier: consts.Geek}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-3", Supplier: consts.V3}, Model: "gpt-4o-image", Price: 0.02},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	getToken := m.GetTokenIterator(WithPrefer(PreferCheapest))
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Equal(t, "sk-1", getToken().Token.Token)
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Nil(t, getToken())
+
+	// 设置 cost_cap 时跳过超出上限和未配置价格的 token
+	getToken = m.GetTokenIterator(WithCostCap(0.05))
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Nil(t, getToken())
+}
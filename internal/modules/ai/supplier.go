@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/consts"
+)
+
+const (
+	AuthSchemeBearer = "bearer" // <auth_header>: Bearer <token>
+	AuthSchemeRaw    = "raw"    // <auth_header>: <token>
+)
+
+// SupplierConfig 中转供应商的接入方式，零值字段使用默认值
+type SupplierConfig struct {
+	BaseURL        string
+	AuthHeader     string // 默认 Authorization
+	AuthScheme     string // bearer|raw，默认 bearer
+	Headers        map[string]string
+	Proxy          *url.URL
+	Timeout        time.Duration // 单次请求超时，0 表示使用调用方的默认值
+	ConnectTimeout time.Duration
+}
+
+type Supplier struct {
+	conf      SupplierConfig
+	transport http.RoundTripper
+}
+
+var gSuppliers atomic.Pointer[map[consts.ModelSupplier]*Supplier]
+
+// SetSuppliers 替换供应商配置，进行中的请求不受影响
+func SetSuppliers(conf map[consts.ModelSupplier]SupplierConfig) {
+	suppliers := make(map[consts.ModelSupplier]*Supplier, len(conf))
+	for name, v := range conf {
+		suppliers[name] = newSupplier(v)
+	}
+	gSuppliers.Store(&suppliers)
+}
+
+func newSupplier(conf SupplierConfig) *Supplier {
+	s := &Supplier{conf: conf, transport: http.DefaultTransport}
+	if conf.Proxy != nil || conf.ConnectTimeout > 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if conf.Proxy != nil {
+			transport.Proxy = http.ProxyURL(conf.Proxy)
+		}
+		if conf.ConnectTimeout > 0 {
+			transport.DialContext = (&net.Dialer{Timeout: conf.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		}
+		s.transport = transport
+	}
+	return s
+}
+
+// GetSupplier 未在 suppliers 中配置时使用内置的 geek/tuzi/v3 地址
+func GetSupplier(name consts.ModelSupplier) *Supplier {
+	if m := gSuppliers.Load(); m != nil {
+		if s, ok := (*m)[name]; ok {
+			return s
+		}
+	}
+	return &Supplier{conf: SupplierConfig{BaseURL: name.BaseURL()}, transport: http.DefaultTransport}
+}
+
+// Known 供应商已配置或内置
+func (s *Supplier) Known() bool {
+	return s.conf.BaseURL != ""
+}
+
+func (s *Supplier) BaseURL() string {
+	return s.conf.BaseURL
+}
+
+// Headers 鉴权头和额外请求头
+func (s *Supplier) Headers(token string) map[string]string {
+	ret := make(map[string]string, len(s.conf.Headers)+1)
+	for k, v := range s.conf.Headers {
+		ret[k] = v
+	}
+	header := s.conf.AuthHeader
+	if header == "" {
+		header = "Authorization"
+	}
+	if s.conf.AuthScheme == AuthSchemeRaw {
+		ret[header] = token
+	} else {
+		ret[header] = "Bearer " + token
+	}
+	return ret
+}
+
+// Client timeout 为调用方的默认超时，供应商配置了 timeout 时优先
+func (s *Supplier) Client(timeout time.Duration) *http.Client {
+	if s.conf.Timeout > 0 {
+		timeout = s.conf.Timeout
+	}
+	return &http.Client{Transport: s.transport, Timeout: timeout}
+}
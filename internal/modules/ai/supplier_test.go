@@ -0,0 +1,34 @@
+package ai
+
+import (
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGetSupplier(t *testing.T) {
+	SetSuppliers(map[consts.ModelSupplier]SupplierConfig{
+		"relay": {
+			BaseURL:    "https://relay.example.com",
+			AuthHeader: "x-api-key",
+			AuthScheme: AuthSchemeRaw,
+			Headers:    map[string]string{"X-Channel": "image"},
+			Timeout:    time.Minute,
+		},
+	})
+	defer gSuppliers.Store(nil)
+
+	relay := GetSupplier("relay")
+	require.True(t, relay.Known())
+	require.Equal(t, "https://relay.example.com", relay.BaseURL())
+	require.Equal(t, map[string]string{"x-api-key": "sk-1", "X-Channel": "image"}, relay.Headers("sk-1"))
+	require.Equal(t, time.Minute, relay.Client(10*time.Minute).Timeout)
+
+	// 未配置时使用内置地址
+	tuzi := GetSupplier(consts.Tuzi)
+	require.Equal(t, consts.Tuzi.BaseURL(), tuzi.BaseURL())
+	require.Equal(t, map[string]string{"Authorization": "Bearer sk-1"}, tuzi.Headers("sk-1"))
+	require.Equal(t, 10*time.Minute, tuzi.Client(10*time.Minute).Timeout)
+	require.False(t, GetSupplier("unknown").Known())
+}
@@ -13,3 +13,13 @@ type Token struct {
 func (t Token) GetSupplier() consts.ModelSupplier {
 	return t.Supplier
 }
+
+// TokenKey 唯一标识一个 token
+type TokenKey struct {
+	Supplier consts.ModelSupplier
+	Desc     string
+}
+
+func (t Token) Key() TokenKey {
+	return TokenKey{Supplier: t.Supplier, Desc: t.Desc}
+}
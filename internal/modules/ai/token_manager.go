@@ -6,63 +6,136 @@ import (
 	"github.com/google/uuid"
 	"github.com/reusedev/draw-hub/internal/consts"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type TokenWithModel struct {
 	Token
-	Model string // supplier model
+	Model  string  // supplier model
+	Weight int     // weighted 策略下的权重，未配置时为 1
+	Price  float64 // 单次请求价格，0 表示未配置
+}
+
+func (t TokenWithModel) weight() int {
+	if t.Weight <= 0 {
+		return 1
+	}
+	return t.Weight
 }
 
 type Client struct {
-	Id       string
-	TryIndex [][]int
+	Id        string
+	TryIndex  [][]int
+	CreatedAt time.Time
+	readyAt   time.Time // 上次选择时被限流的 token 中最早可用的时间
 }
 
 func (c *Client) CanTry(i, j int) bool {
 	return c.TryIndex[i][j] == 0
 }
 
-func (c *Client) FirstRequest() bool {
-	for _, row := range c.TryIndex {
-		for _, column := range row {
-			if column != 0 {
-				return false
-			}
-		}
+type TokenManager struct {
+	Token    [][]TokenWithModel
+	Breakers map[TokenKey]*Breaker
+	Lock     *sync.Mutex
+
+	Client []*Client
+
+	model               string
+	statistics          map[TokenKey]*tokenStats
+	strategies          []RoutingStrategy // 按 Token 分组下标
+	cursor              map[int]int       // round_robin 各分组的游标
+	hedge               int
+	drained             map[TokenKey]time.Time // 排空时间，之后创建的迭代器不再使用该 token
+	disabled            map[TokenKey]bool
+	breakerConfig       BreakerConfig
+	escalateSupplierBan bool
+}
+
+// gTokenManager [model(gpt-image-1|gemini-2.5-flash-image|...)]TokenManager，重新加载配置时整体替换
+var gTokenManager atomic.Pointer[map[string]*TokenManager]
+
+// GetTokenManager 当前配置下该模型的 TokenManager，未配置时返回 nil
+func GetTokenManager(model string) *TokenManager {
+	return TokenManagers()[model]
+}
+
+// TokenManagers 当前配置下所有模型的 TokenManager，不要修改返回的 map
+func TokenManagers() map[string]*TokenManager {
+	m := gTokenManager.Load()
+	if m == nil {
+		return nil
 	}
-	return true
+	return *m
 }
 
-type TokenManager struct {
-	BanSupplier []consts.ModelSupplier
-	ExpiredAt   []time.Time
-	Token       [][]TokenWithModel
-	Lock        *sync.Mutex
+// Current 重新加载配置后返回同一模型分类的新 TokenManager，分类已被移除时返回自身；
+// 在加载前创建的迭代器通过它把请求结果记录到新的熔断器
+func (t *TokenManager) Current() *TokenManager {
+	if m := GetTokenManager(t.model); m != nil {
+		return m
+	}
+	return t
+}
 
-	Client []*Client
+// Budget token 的调用预算，额度用完的 token 在窗口重置前跳过；
+// Allow 在选取 token 时判断，Consume 在供应商返回结果后计入，失败或被取消的请求不占用额度
+type Budget interface {
+	Allow(token TokenWithModel) bool
+	Consume(token TokenWithModel)
 }
 
-// GTokenManager [model(gpt-image-1|gemini-2.5-flash-image|...)]TokenManager
-var GTokenManager map[string]*TokenManager
+// GBudget 为 nil 时不限制
+var GBudget Budget
 
-func InitTokenManager(ctx context.Context, cla []string, tokens [][][]TokenWithModel) error {
-	if len(cla) != len(tokens) {
-		return fmt.Errorf("init token manager error")
+type Option func(*TokenManager)
+
+// WithSupplierBanEscalation 某模型下一个供应商的 token 全部熔断时，在所有模型下熔断该供应商
+func WithSupplierBanEscalation(escalate bool) Option {
+	return func(t *TokenManager) {
+		t.escalateSupplierBan = escalate
 	}
-	GTokenManager = make(map[string]*TokenManager)
-	for i := 0; i < len(cla); i++ {
-		GTokenManager[cla[i]] = &TokenManager{
-			Token: tokens[i],
-			Lock:  &sync.Mutex{},
+}
+
+func WithBreakerConfig(conf BreakerConfig) Option {
+	return func(t *TokenManager) {
+		t.breakerConfig = conf
+	}
+}
+
+// WithRouting 各模型每个分组的路由策略，未配置的分组使用 defaultStrategy
+func WithRouting(defaultStrategy RoutingStrategy, strategies map[string][]RoutingStrategy) Option {
+	return func(t *TokenManager) {
+		t.strategies = make([]RoutingStrategy, len(t.Token))
+		for i := range t.strategies {
+			t.strategies[i] = defaultStrategy
+			if i < len(strategies[t.model]) {
+				t.strategies[i] = strategies[t.model][i]
+			}
 		}
 	}
+}
+
+// WithHedge 各模型并行请求的 token 数，未配置或小于 2 的模型逐个请求
+func WithHedge(hedge map[string]int) Option {
+	return func(t *TokenManager) {
+		t.hedge = hedge[t.model]
+	}
+}
+
+func InitTokenManager(ctx context.Context, cla []string, tokens [][][]TokenWithModel, opts ...Option) error {
+	managers, err := newTokenManagers(cla, tokens, opts...)
+	if err != nil {
+		return err
+	}
+	gTokenManager.Store(&managers)
 	go func() {
 		t := time.NewTicker(1 * time.Second)
 		for {
 			select {
 			case <-t.C:
-				for _, manager := range GTokenManager {
+				for _, manager := range TokenManagers() {
 					manager.tidy()
 				}
 			case <-ctx.Done():
@@ -73,27 +146,298 @@ func InitTokenManager(ctx context.Context, cla []string, tokens [][][]TokenWithM
 	return nil
 }
 
-func (t *TokenManager) Ban(supplier consts.ModelSupplier, expiredAt time.Time) {
+// ReloadTokenManager 用新的配置替换所有 TokenManager，同一 token 沿用原有的熔断状态和统计；
+// 已经创建的迭代器继续使用旧的 TokenManager 直到结束
+func ReloadTokenManager(cla []string, tokens [][][]TokenWithModel, opts ...Option) error {
+	managers, err := newTokenManagers(cla, tokens, opts...)
+	if err != nil {
+		return err
+	}
+	old := TokenManagers()
+	for model, m := range managers {
+		if o, ok := old[model]; ok {
+			m.inherit(o)
+		}
+	}
+	gTokenManager.Store(&managers)
+	return nil
+}
+
+func newTokenManagers(cla []string, tokens [][][]TokenWithModel, opts ...Option) (map[string]*TokenManager, error) {
+	if len(cla) != len(tokens) {
+		return nil, fmt.Errorf("init token manager error")
+	}
+	managers := make(map[string]*TokenManager)
+	for i := 0; i < len(cla); i++ {
+		m := &TokenManager{
+			Token:         tokens[i],
+			Breakers:      make(map[TokenKey]*Breaker),
+			Lock:          &sync.Mutex{},
+			model:         cla[i],
+			breakerConfig: DefaultBreakerConfig,
+		}
+		for _, opt := range opts {
+			opt(m)
+		}
+		managers[cla[i]] = m
+	}
+	return managers, nil
+}
+
+// inherit 复制旧 TokenManager 中仍存在的 token 的熔断状态和统计
+func (t *TokenManager) inherit(old *TokenManager) {
+	old.Lock.Lock()
+	defer old.Lock.Unlock()
+	for _, tokens := range t.Token {
+		for _, token := range tokens {
+			key := token.Key()
+			if b, ok := old.Breakers[key]; ok {
+				c := *b
+				c.conf = t.conf()
+				c.outcomes = append([]outcome(nil), b.outcomes...)
+				t.breaker(key)
+				t.Breakers[key] = &c
+			}
+			if s, ok := old.statistics[key]; ok {
+				c := *s
+				*t.stats(token.Token) = c
+			}
+			if v, ok := old.drained[key]; ok {
+				t.setDrained(key, v)
+			}
+			if old.disabled[key] {
+				t.setDisabled(key, true)
+			}
+		}
+	}
+}
+
+// Report 记录 token 的请求结果和成功请求的耗时，错误率过高时熔断
+func (t *TokenManager) Report(token Token, success bool, latency time.Duration) {
 	t.Lock.Lock()
-	defer t.Lock.Unlock()
+	now := time.Now()
+	t.stats(token).record(success, latency)
+	opened := t.breaker(token.Key()).Record(now, success)
+	escalate := opened && t.escalateSupplierBan && !t.supplierAvailable(token.Supplier, now)
+	t.Lock.Unlock()
+	if escalate {
+		t.openSupplier(token.Supplier, now.Add(t.breakerConfig.OpenDuration))
+	}
+}
 
-	for _, v := range t.BanSupplier {
-		if v == supplier {
-			return
+// Ban 手动熔断单个 token（供应商 + desc）到 expiredAt
+func (t *TokenManager) Ban(token Token, expiredAt time.Time) {
+	t.Lock.Lock()
+	now := time.Now()
+	t.breaker(token.Key()).ForceOpen(now, expiredAt)
+	escalate := t.escalateSupplierBan && !t.supplierAvailable(token.Supplier, now)
+	t.Lock.Unlock()
+	if escalate {
+		t.openSupplier(token.Supplier, expiredAt)
+	}
+}
+
+// Extend 熔断单个 token 到 until，已熔断到更晚时间时不变；返回熔断截止时间是否为 until
+func (t *TokenManager) Extend(token Token, until time.Time) bool {
+	t.Lock.Lock()
+	now := time.Now()
+	b := t.breaker(token.Key())
+	if b.State(now) == BreakerOpen && b.openUntil.After(until) {
+		t.Lock.Unlock()
+		return false
+	}
+	b.ForceOpen(now, until)
+	escalate := t.escalateSupplierBan && !t.supplierAvailable(token.Supplier, now)
+	t.Lock.Unlock()
+	if escalate {
+		t.openSupplier(token.Supplier, until)
+	}
+	return true
+}
+
+// openSupplier 在所有模型下熔断该供应商的 token
+func (t *TokenManager) openSupplier(supplier consts.ModelSupplier, until time.Time) {
+	managers := []*TokenManager{t}
+	for _, m := range TokenManagers() {
+		if m != t {
+			managers = append(managers, m)
+		}
+	}
+	for _, m := range managers {
+		m.Lock.Lock()
+		now := time.Now()
+		for _, tokens := range m.Token {
+			for _, token := range tokens {
+				b := m.breaker(token.Key())
+				if token.Supplier == supplier && b.Available(now) {
+					b.ForceOpen(now, until)
+				}
+			}
+		}
+		m.Lock.Unlock()
+	}
+}
+
+func (t *TokenManager) supplierAvailable(supplier consts.ModelSupplier, now time.Time) bool {
+	for _, tokens := range t.Token {
+		for _, token := range tokens {
+			if token.Supplier == supplier && t.breaker(token.Key()).Available(now) {
+				return true
+			}
 		}
 	}
-	t.BanSupplier = append(t.BanSupplier, supplier)
-	t.ExpiredAt = append(t.ExpiredAt, expiredAt)
+	return false
 }
 
-func (t *TokenManager) GetTokenIterator() func() *TokenWithModel {
+type TokenBreaker struct {
+	Supplier consts.ModelSupplier `json:"supplier"`
+	Desc     string               `json:"desc"`
+	BreakerSnapshot
+	LatencyMs   float64 `json:"latency_ms"`   // 成功请求耗时的 EWMA
+	SuccessRate float64 `json:"success_rate"` // 成功率的 EWMA
+}
+
+func (t *TokenManager) BreakerStates() []TokenBreaker {
+	t.Lock.Lock()
+	defer t.Lock.Unlock()
+	now := time.Now()
+	ret := make([]TokenBreaker, 0)
+	seen := make(map[TokenKey]struct{})
+	for _, tokens := range t.Token {
+		for _, token := range tokens {
+			key := token.Key()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			ret = append(ret, TokenBreaker{
+				Supplier:        key.Supplier,
+				Desc:            key.Desc,
+				BreakerSnapshot: t.breaker(key).Snapshot(now),
+				LatencyMs:       t.stats(token.Token).latencyMs,
+				SuccessRate:     t.successRate(token.Token),
+			})
+		}
+	}
+	return ret
+}
+
+type IteratorOption func(*iteratorOptions)
+
+type iteratorOptions struct {
+	ctx      context.Context
+	supplier consts.ModelSupplier
+	costCap  float64
+	prefer   Prefer
+	affinity *TokenWithModel
+}
+
+// WithContext 等待被限流的 token 时，ctx 结束即停止等待并返回空结果
+func WithContext(ctx context.Context) IteratorOption {
+	return func(o *iteratorOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithSupplier 只返回该供应商的 token
+func WithSupplier(supplier consts.ModelSupplier) IteratorOption {
+	return func(o *iteratorOptions) {
+		o.supplier = supplier
+	}
+}
+
+// WithCostCap 跳过单次请求价格高于 costCap 的 token；未配置价格的 token 无法判断是否超出，也会被跳过
+func WithCostCap(costCap float64) IteratorOption {
+	return func(o *iteratorOptions) {
+		o.costCap = costCap
+	}
+}
+
+// WithPrefer 不按分组顺序，在所有分组中优先选择最便宜或最快的 token
+func WithPrefer(prefer Prefer) IteratorOption {
+	return func(o *iteratorOptions) {
+		o.prefer = prefer
+	}
+}
+
+// WithAffinity 先尝试该 token（按供应商、desc 和供应商模型匹配），不可用或失败后按正常顺序选择
+func WithAffinity(key TokenKey, model string) IteratorOption {
+	return func(o *iteratorOptions) {
+		o.affinity = &TokenWithModel{Token: Token{Supplier: key.Supplier, Desc: key.Desc}, Model: model}
+	}
+}
+
+func (t *TokenManager) GetTokenIterator(opts ...IteratorOption) func() *TokenWithModel {
 	clientId := uuid.NewString()
+	options := &iteratorOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(options)
+	}
 	return func() *TokenWithModel {
-		return t.getToken(clientId)
+		tokens := t.waitTokens(clientId, options, 1)
+		if len(tokens) == 0 {
+			return nil
+		}
+		return tokens[0]
+	}
+}
+
+// GetTokenBatchIterator 每次从同一分组中取最多 n 个 token，用于并行请求
+func (t *TokenManager) GetTokenBatchIterator(n int, opts ...IteratorOption) func() []*TokenWithModel {
+	clientId := uuid.NewString()
+	options := &iteratorOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return func() []*TokenWithModel {
+		return t.waitTokens(clientId, options, n)
+	}
+}
+
+// Hedge 并行请求的 token 数，至少为 1
+func (t *TokenManager) Hedge() int {
+	if t == nil || t.hedge < 1 {
+		return 1
+	}
+	return t.hedge
+}
+
+func (t *TokenManager) HasSupplier(supplier consts.ModelSupplier) bool {
+	if t == nil {
+		return false
 	}
+	for _, tokens := range t.Token {
+		for _, token := range tokens {
+			if token.Supplier == supplier {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func (t *TokenManager) getToken(clientId string) *TokenWithModel {
+// waitTokens 没有可用 token 且有 token 只是被限流时，等待其恢复，最多等待 RateLimitConfig.MaxWait；
+// 等待期间 options.ctx 结束时返回 nil
+func (t *TokenManager) waitTokens(clientId string, options *iteratorOptions, n int) []*TokenWithModel {
+	deadline := time.Now().Add(gRateLimiter.maxWait())
+	for {
+		tokens, readyAt := t.getTokens(clientId, options, n)
+		if len(tokens) > 0 || readyAt.IsZero() || readyAt.After(deadline) {
+			return tokens
+		}
+		select {
+		case <-options.ctx.Done():
+			return nil
+		case <-time.After(time.Until(readyAt)):
+		}
+	}
+}
+
+// getTokens 未配置的模型分类（t 为 nil）没有可用 token；没有可用 token 时同时返回被限流的 token 最早可用的时间
+func (t *TokenManager) getTokens(clientId string, options *iteratorOptions, n int) ([]*TokenWithModel, time.Time) {
+	if t == nil {
+		return nil, time.Time{}
+	}
 	t.Lock.Lock()
 	defer t.Lock.Unlock()
 
@@ -105,69 +449,126 @@ func (t *TokenManager) getToken(clientId string) *TokenWithModel {
 		}
 	}
 	if client == nil {
-		client = &Client{Id: clientId, TryIndex: make([][]int, len(t.Token))}
+		client = &Client{Id: clientId, TryIndex: make([][]int, len(t.Token)), CreatedAt: time.Now()}
 		for i := range client.TryIndex {
 			client.TryIndex[i] = make([]int, len(t.Token[i]))
 		}
 		t.Client = append(t.Client, client)
 	}
-
-	token := t.getValidToken(client)
-	if token != nil {
-		return token
-	}
-	if client.FirstRequest() {
-		t.popBanSupplierIfAllBan()
-		token := t.getValidToken(client)
-		return token
-	}
-	return nil
+	client.readyAt = time.Time{}
+	return t.getValidTokens(client, options, n), client.readyAt
 }
 
-func (t *TokenManager) popBanSupplierIfAllBan() {
-	var hasValidToken bool
-	for _, tokens := range t.Token {
-		for _, token := range tokens {
-			if t.validToken(token) {
-				hasValidToken = true
-				break
+// getValidTokens 从第一个还有可用 token 的分组中按策略取最多 n 个
+func (t *TokenManager) getValidTokens(client *Client, options *iteratorOptions, n int) []*TokenWithModel {
+	now := time.Now()
+	if options.affinity != nil {
+		affinity := options.affinity
+		// 只尝试一次
+		options.affinity = nil
+		for i, tokens := range t.Token {
+			for j, token := range tokens {
+				if token.Key() == affinity.Key() && token.Model == affinity.Model && t.usable(client, options, i, j, now) {
+					return []*TokenWithModel{t.take(client, i, j, now)}
+				}
 			}
 		}
 	}
-	if !hasValidToken {
-		t.BanSupplier = t.BanSupplier[1:]
-		t.ExpiredAt = t.ExpiredAt[1:]
+	if options.prefer != "" {
+		return t.getPreferredTokens(client, options, n, now)
 	}
-}
-
-func (t *TokenManager) getValidToken(client *Client) *TokenWithModel {
 	for i, tokens := range t.Token {
-		for j, token := range tokens {
-			if client.CanTry(i, j) && t.validToken(token) {
-				client.TryIndex[i][j] = 1
-				return &token
+		candidates := make([]int, 0, len(tokens))
+		for j := range tokens {
+			if t.usable(client, options, i, j, now) {
+				candidates = append(candidates, j)
 			}
 		}
+		if len(candidates) == 0 {
+			continue
+		}
+		ret := make([]*TokenWithModel, 0, n)
+		for len(candidates) > 0 && len(ret) < n {
+			j := t.pick(i, candidates)
+			ret = append(ret, t.take(client, i, j, now))
+			for k, v := range candidates {
+				if v == j {
+					candidates = append(candidates[:k], candidates[k+1:]...)
+					break
+				}
+			}
+		}
+		return ret
 	}
 	return nil
 }
 
-func (t *TokenManager) validToken(token TokenWithModel) bool {
-	for _, supplier := range t.BanSupplier {
-		if token.GetSupplier() == supplier {
-			return false
+func (t *TokenManager) usable(client *Client, options *iteratorOptions, i, j int, now time.Time) bool {
+	token := t.Token[i][j]
+	if options.supplier != "" && token.Supplier != options.supplier {
+		return false
+	}
+	if options.costCap > 0 && (token.Price == 0 || token.Price > options.costCap) {
+		return false
+	}
+	if !client.CanTry(i, j) {
+		return false
+	}
+	if t.disabled[token.Key()] {
+		return false
+	}
+	if drainedAt, ok := t.drained[token.Key()]; ok && !client.CreatedAt.Before(drainedAt) {
+		return false
+	}
+	if GBudget != nil && !GBudget.Allow(token) {
+		return false
+	}
+	if !t.breaker(token.Key()).Available(now) {
+		return false
+	}
+	if ready := gRateLimiter.readyAt(token.Key(), now); ready.After(now) {
+		if client.readyAt.IsZero() || ready.Before(client.readyAt) {
+			client.readyAt = ready
 		}
+		return false
 	}
 	return true
 }
 
+// take 占用 token：half-open 的试探名额和迭代器的尝试记录；预算在供应商返回结果后才计入
+func (t *TokenManager) take(client *Client, i, j int, now time.Time) *TokenWithModel {
+	token := t.Token[i][j]
+	t.breaker(token.Key()).Acquire(now)
+	gRateLimiter.take(token.Key(), now)
+	client.TryIndex[i][j] = 1
+	return &token
+}
+
+// breaker 需持有 t.Lock
+func (t *TokenManager) breaker(key TokenKey) *Breaker {
+	if t.Breakers == nil {
+		t.Breakers = make(map[TokenKey]*Breaker)
+	}
+	b, ok := t.Breakers[key]
+	if !ok {
+		b = NewBreaker(t.conf())
+		t.Breakers[key] = b
+	}
+	return b
+}
+
+func (t *TokenManager) conf() BreakerConfig {
+	if t.breakerConfig == (BreakerConfig{}) {
+		return DefaultBreakerConfig
+	}
+	return t.breakerConfig
+}
+
 func (t *TokenManager) tidy() {
 	t.Lock.Lock()
 	defer t.Lock.Unlock()
-	for i := len(t.ExpiredAt) - 1; i >= 0; i-- {
-		if t.ExpiredAt[i].Before(time.Now()) {
-			t.BanSupplier = append(t.BanSupplier[:i], t.BanSupplier[i+1:]...)
-			t.ExpiredAt = append(t.ExpiredAt[:i], t.ExpiredAt[i+1:]...)
-		}
+	now := time.Now()
+	for _, b := range t.Breakers {
+		b.prune(now)
 	}
 }
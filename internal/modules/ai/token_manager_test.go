@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"context"
 	"github.com/reusedev/draw-hub/internal/consts"
 	"github.com/stretchr/testify/require"
 	"sync"
@@ -13,18 +14,18 @@ func TestGetToken(t *testing.T) {
 		Token: [][]TokenWithModel{
 			{
 				{
-					Token{Token: "sk-1"},
-					"gpt-4o-image",
+					Token: Token{Token: "sk-1"},
+					Model: "gpt-4o-image",
 				},
 				{
-					Token{Token: "sk-2"},
-					"gpt-4o-image",
+					Token: Token{Token: "sk-2"},
+					Model: "gpt-4o-image",
 				},
 			},
 			{
 				{
-					Token{Token: "sk-3"},
-					"gpt-4o-image-vip",
+					Token: Token{Token: "sk-3"},
+					Model: "gpt-4o-image-vip",
 				},
 			},
 		},
@@ -42,33 +43,51 @@ func TestGetToken(t *testing.T) {
 	}
 	require.Equal(t, []*TokenWithModel{
 		{
-			Token{Token: "sk-1"},
-			"gpt-4o-image",
+			Token: Token{Token: "sk-1"},
+			Model: "gpt-4o-image",
 		},
 		{
-			Token{Token: "sk-2"},
-			"gpt-4o-image",
+			Token: Token{Token: "sk-2"},
+			Model: "gpt-4o-image",
 		},
 		{
-			Token{Token: "sk-3"},
-			"gpt-4o-image-vip",
+			Token: Token{Token: "sk-3"},
+			Model: "gpt-4o-image-vip",
 		}}, tokens)
 }
 
 func TestTidy(t *testing.T) {
 	fiveMinLater := time.Now().Add(5 * time.Minute)
 	m := TokenManager{
-		BanSupplier: []consts.ModelSupplier{
-			consts.Tuzi,
-			consts.Geek,
-			consts.V3,
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Supplier: consts.Tuzi}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-2", Supplier: consts.Geek}, Model: "gpt-4o-image"},
+				{Token: Token{Token: "sk-3", Supplier: consts.V3}, Model: "gpt-4o-image"},
+			},
 		},
-		ExpiredAt: []time.Time{time.Now().Add(-5 * time.Minute), fiveMinLater, time.Now().Add(-5 * time.Minute)},
-		Lock:      &sync.Mutex{},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
 	}
+	m.Ban(Token{Token: "sk-1", Supplier: consts.Tuzi}, time.Now().Add(-5*time.Minute))
+	m.Ban(Token{Token: "sk-2", Supplier: consts.Geek}, fiveMinLater)
+	// 统计窗口之外的请求记录
+	m.breaker(Token{Token: "sk-3", Supplier: consts.V3}.Key()).Record(time.Now().Add(-10*time.Minute), false)
 	m.tidy()
-	require.Equal(t, []consts.ModelSupplier{consts.Geek}, m.BanSupplier)
-	require.Equal(t, []time.Time{fiveMinLater}, m.ExpiredAt)
+
+	now := time.Now()
+	require.Equal(t, BreakerHalfOpen, m.Breakers[Token{Supplier: consts.Tuzi}.Key()].State(now))
+	snapshot := m.Breakers[Token{Supplier: consts.Geek}.Key()].Snapshot(now)
+	require.Equal(t, BreakerOpen, snapshot.State)
+	require.Equal(t, fiveMinLater, *snapshot.OpenUntil)
+	require.Empty(t, m.Breakers[Token{Supplier: consts.V3}.Key()].outcomes)
+
+	// 过期的熔断只允许一个试探请求，成功后关闭
+	require.Equal(t, "sk-1", m.GetTokenIterator()().Token.Token)
+	require.Equal(t, "sk-3", m.GetTokenIterator()().Token.Token)
+	m.Report(Token{Token: "sk-1", Supplier: consts.Tuzi}, true, time.Second)
+	require.Equal(t, BreakerClosed, m.Breakers[Token{Supplier: consts.Tuzi}.Key()].State(now))
+	require.Equal(t, "sk-1", m.GetTokenIterator()().Token.Token)
 }
 
 func TestBanToken(t *testing.T) {
@@ -76,26 +95,25 @@ func TestBanToken(t *testing.T) {
 		Token: [][]TokenWithModel{
 			{
 				{
-					Token{Token: "sk-1", Supplier: consts.Tuzi},
-					"gpt-4o-image",
+					Token: Token{Token: "sk-1", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
 				},
 				{
-					Token{Token: "sk-2", Supplier: consts.Tuzi},
-					"gpt-4o-image",
+					Token: Token{Token: "sk-2", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
 				},
 			},
 			{
 				{
-					Token{Token: "sk-3", Supplier: consts.Geek},
-					"gpt-4o-image-vip",
+					Token: Token{Token: "sk-3", Supplier: consts.Geek},
+					Model: "gpt-4o-image-vip",
 				},
 			},
 		},
 		Lock:   &sync.Mutex{},
 		Client: make([]*Client, 0),
 	}
-	//m.Ban(consts.Tuzi, time.Now().Add(time.Hour))
-	m.Ban(consts.Geek, time.Now().Add(time.Hour))
+	m.Ban(Token{Token: "sk-3", Supplier: consts.Geek}, time.Now().Add(time.Hour))
 
 	tokens := make([]*TokenWithModel, 0)
 	getToken := m.GetTokenIterator()
@@ -108,11 +126,239 @@ func TestBanToken(t *testing.T) {
 	}
 	require.Equal(t, []*TokenWithModel{
 		{
-			Token{Token: "sk-1", Supplier: consts.Tuzi},
-			"gpt-4o-image",
+			Token: Token{Token: "sk-1", Supplier: consts.Tuzi},
+			Model: "gpt-4o-image",
+		},
+		{
+			Token: Token{Token: "sk-2", Supplier: consts.Tuzi},
+			Model: "gpt-4o-image",
+		}}, tokens)
+}
+
+func TestGetTokenWithSupplier(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{
+					Token: Token{Token: "sk-1", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
+				},
+				{
+					Token: Token{Token: "sk-2", Supplier: consts.Geek},
+					Model: "gpt-4o-image",
+				},
+			},
+			{
+				{
+					Token: Token{Token: "sk-3", Supplier: consts.Geek},
+					Model: "gpt-4o-image-vip",
+				},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	require.True(t, m.HasSupplier(consts.Geek))
+	require.False(t, m.HasSupplier(consts.V3))
+
+	tokens := make([]*TokenWithModel, 0)
+	getToken := m.GetTokenIterator(WithSupplier(consts.Geek))
+	for {
+		token := getToken()
+		if token == nil {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	require.Equal(t, []*TokenWithModel{
+		{
+			Token: Token{Token: "sk-2", Supplier: consts.Geek},
+			Model: "gpt-4o-image",
 		},
 		{
-			Token{Token: "sk-2", Supplier: consts.Tuzi},
-			"gpt-4o-image",
+			Token: Token{Token: "sk-3", Supplier: consts.Geek},
+			Model: "gpt-4o-image-vip",
 		}}, tokens)
 }
+
+func TestBanSingleToken(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{
+					Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
+				},
+				{
+					Token: Token{Token: "sk-2", Desc: "multichannel", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
+				},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	m.Ban(Token{Token: "sk-2", Desc: "multichannel", Supplier: consts.Tuzi}, time.Now().Add(time.Hour))
+
+	getToken := m.GetTokenIterator()
+	require.Equal(t, "sk-1", getToken().Token.Token)
+	require.Nil(t, getToken())
+}
+
+func TestReportOpensBreaker(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{
+					Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi},
+					Model: "gpt-4o-image",
+				},
+				{
+					Token: Token{Token: "sk-2", Desc: "default", Supplier: consts.Geek},
+					Model: "gpt-4o-image",
+				},
+			},
+		},
+		Lock:          &sync.Mutex{},
+		Client:        make([]*Client, 0),
+		breakerConfig: BreakerConfig{Window: time.Minute, MinRequests: 2, ErrorRate: 0.5, OpenDuration: time.Hour},
+	}
+	tuzi := Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}
+	m.Report(tuzi, false, 0)
+	require.Equal(t, "sk-1", m.GetTokenIterator()().Token.Token)
+	m.Report(tuzi, false, 0)
+	require.Equal(t, "sk-2", m.GetTokenIterator()().Token.Token)
+
+	states := m.BreakerStates()
+	require.Len(t, states, 2)
+	require.Equal(t, BreakerOpen, states[0].State)
+	require.Equal(t, BreakerClosed, states[1].State)
+}
+
+func TestBanEscalation(t *testing.T) {
+	newManager := func() *TokenManager {
+		return &TokenManager{
+			Token: [][]TokenWithModel{
+				{
+					{
+						Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi},
+						Model: "gpt-4o-image",
+					},
+					{
+						Token: Token{Token: "sk-2", Desc: "multichannel", Supplier: consts.Tuzi},
+						Model: "gpt-4o-image",
+					},
+					{
+						Token: Token{Token: "sk-3", Desc: "default", Supplier: consts.Geek},
+						Model: "gpt-4o-image",
+					},
+				},
+			},
+			Lock:                &sync.Mutex{},
+			Client:              make([]*Client, 0),
+			escalateSupplierBan: true,
+		}
+	}
+	m, other := newManager(), newManager()
+	gTokenManager.Store(&map[string]*TokenManager{"a": m, "b": other})
+	defer gTokenManager.Store(nil)
+
+	m.Ban(Token{Desc: "default", Supplier: consts.Tuzi}, time.Now().Add(time.Hour))
+	require.Equal(t, "sk-1", other.GetTokenIterator()().Token.Token)
+	m.Ban(Token{Desc: "multichannel", Supplier: consts.Tuzi}, time.Now().Add(time.Hour))
+
+	getToken := other.GetTokenIterator()
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Nil(t, getToken())
+}
+
+func TestGetTokenBatch(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Supplier: consts.Tuzi}, Model: "gemini-2.5-flash-image"},
+				{Token: Token{Token: "sk-2", Supplier: consts.Geek}, Model: "gemini-2.5-flash-image"},
+				{Token: Token{Token: "sk-3", Supplier: consts.V3}, Model: "gemini-2.5-flash-image"},
+			},
+			{
+				{Token: Token{Token: "sk-4", Supplier: consts.Tuzi}, Model: "gemini-2.5-flash-image-vip"},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+		hedge:  2,
+	}
+	getTokens := m.GetTokenBatchIterator(m.Hedge())
+	tokens := func() []string {
+		ret := make([]string, 0)
+		for _, v := range getTokens() {
+			ret = append(ret, v.Token.Token)
+		}
+		return ret
+	}
+	// 每批只取同一分组内的 token
+	require.Equal(t, []string{"sk-1", "sk-2"}, tokens())
+	require.Equal(t, []string{"sk-3"}, tokens())
+	require.Equal(t, []string{"sk-4"}, tokens())
+	require.Empty(t, tokens())
+}
+
+func TestReloadTokenManager(t *testing.T) {
+	tuzi := TokenWithModel{Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gpt-4o-image"}
+	geek := TokenWithModel{Token: Token{Token: "sk-2", Desc: "low_price", Supplier: consts.Geek}, Model: "gpt-4o-image"}
+	v3 := TokenWithModel{Token: Token{Token: "sk-3", Desc: "default", Supplier: consts.V3}, Model: "gpt-4o-image"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer gTokenManager.Store(nil)
+	require.NoError(t, InitTokenManager(ctx, []string{"gpt-4o-image"}, [][][]TokenWithModel{{{tuzi, geek}}}))
+	old := GetTokenManager("gpt-4o-image")
+	old.Ban(tuzi.Token, time.Now().Add(time.Hour))
+	getToken := old.GetTokenIterator()
+
+	require.NoError(t, ReloadTokenManager([]string{"gpt-4o-image"}, [][][]TokenWithModel{{{v3}, {tuzi}}}))
+	m := GetTokenManager("gpt-4o-image")
+	require.NotSame(t, old, m)
+
+	// 进行中的迭代器使用旧的 token 列表
+	require.Equal(t, "sk-2", getToken().Token.Token)
+	require.Nil(t, getToken())
+
+	// 新的 TokenManager 沿用熔断状态
+	getToken = m.GetTokenIterator()
+	require.Equal(t, "sk-3", getToken().Token.Token)
+	require.Nil(t, getToken())
+
+	// 旧迭代器的请求结果记录到新的 TokenManager
+	require.Same(t, m, old.Current())
+	old.Current().Ban(v3.Token, time.Now().Add(time.Hour))
+	require.Nil(t, m.GetTokenIterator()())
+}
+
+func TestGetTokenWithAffinity(t *testing.T) {
+	m := TokenManager{
+		Token: [][]TokenWithModel{
+			{
+				{Token: Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gemini-2.5-flash-image"},
+			},
+			{
+				{Token: Token{Token: "sk-2", Desc: "default", Supplier: consts.Geek}, Model: "gemini-2.5-flash-image"},
+				{Token: Token{Token: "sk-3", Desc: "default", Supplier: consts.V3}, Model: "gemini-2.5-flash-image"},
+			},
+		},
+		Lock:   &sync.Mutex{},
+		Client: make([]*Client, 0),
+	}
+	tokens := func(opts ...IteratorOption) []string {
+		ret := make([]string, 0)
+		getToken := m.GetTokenIterator(opts...)
+		for token := getToken(); token != nil; token = getToken() {
+			ret = append(ret, token.Token.Token)
+		}
+		return ret
+	}
+	require.Equal(t, []string{"sk-3", "sk-1", "sk-2"}, tokens(WithAffinity(TokenKey{Supplier: consts.V3, Desc: "default"}, "gemini-2.5-flash-image")))
+	// 供应商模型不一致时不生效
+	require.Equal(t, []string{"sk-1", "sk-2", "sk-3"}, tokens(WithAffinity(TokenKey{Supplier: consts.V3, Desc: "default"}, "gemini-2.5-flash-image-hd")))
+	// 不满足其他条件时不生效
+	require.Equal(t, []string{"sk-2"}, tokens(WithSupplier(consts.Geek), WithAffinity(TokenKey{Supplier: consts.V3, Desc: "default"}, "gemini-2.5-flash-image")))
+}
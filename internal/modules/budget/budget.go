@@ -0,0 +1,291 @@
+package budget
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// syncInterval 多实例共用预算时，定期从 MySQL 同步其他实例的用量
+const syncInterval = 30 * time.Second
+
+type usageKey struct {
+	token  ai.TokenKey
+	period string
+}
+
+type usage struct {
+	requests int
+	amount   float64
+}
+
+// Tracker 记录各 token 当前周期的用量，内存计数，异步累加到 MySQL
+type Tracker struct {
+	lock    sync.Mutex
+	limits  map[ai.TokenKey]config.TokenBudget
+	usage   map[usageKey]*usage
+	persist func(key usageKey, requests int, amount float64)
+	now     func() time.Time
+	price   func(key ai.TokenKey) float64
+}
+
+var GTracker *Tracker
+
+func NewTracker(tokens []config.Token) *Tracker {
+	t := &Tracker{
+		usage: make(map[usageKey]*usage),
+		now:   time.Now,
+		price: cheapest,
+	}
+	t.SetLimits(tokens)
+	return t
+}
+
+// SetLimits 更新预算配置，已记录的用量不变
+func (t *Tracker) SetLimits(tokens []config.Token) {
+	limits := make(map[ai.TokenKey]config.TokenBudget)
+	for _, v := range tokens {
+		if v.Budget.Limited() {
+			limits[ai.TokenKey{Supplier: consts.ModelSupplier(v.Supplier), Desc: v.Desc}] = v.Budget
+		}
+	}
+	t.lock.Lock()
+	t.limits = limits
+	t.lock.Unlock()
+}
+
+// Init 加载当前周期的用量并启用预算限制，重新加载配置时更新预算
+func Init(ctx context.Context) {
+	t := NewTracker(config.Get().Token)
+	t.persist = persist
+	config.OnReload(func() {
+		t.SetLimits(config.Get().Token)
+		if err := t.sync(); err != nil {
+			logs.Logger.Err(err).Msg("Load token usage error")
+		}
+	})
+	if err := t.sync(); err != nil {
+		logs.Logger.Err(err).Msg("Load token usage error")
+	}
+	GTracker = t
+	ai.GBudget = t
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.sync(); err != nil {
+					logs.Logger.Err(err).Msg("Sync token usage error")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (t *Tracker) Allow(token ai.TokenWithModel) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	limit, ok := t.limits[token.Key()]
+	if !ok {
+		return true
+	}
+	u, _ := t.current(token.Key(), limit)
+	return !exceeded(limit, u, token.Price)
+}
+
+// exceeded 再按 price 调用一次会超出预算
+func exceeded(limit config.TokenBudget, u *usage, price float64) bool {
+	if limit.Requests > 0 && u.requests >= limit.Requests {
+		return true
+	}
+	return limit.Amount > 0 && u.amount+price > limit.Amount
+}
+
+// cheapest token 在当前配置各模型中的最低单价，按它也超出预算时 Allow 拒绝该 token 的所有模型
+func cheapest(key ai.TokenKey) float64 {
+	ret, found := 0.0, false
+	for _, manager := range ai.TokenManagers() {
+		for _, tokens := range manager.Token {
+			for _, token := range tokens {
+				if token.Key() == key && (!found || token.Price < ret) {
+					ret, found = token.Price, true
+				}
+			}
+		}
+	}
+	return ret
+}
+
+func (t *Tracker) Consume(token ai.TokenWithModel) {
+	t.lock.Lock()
+	limit, ok := t.limits[token.Key()]
+	if !ok {
+		t.lock.Unlock()
+		return
+	}
+	u, key := t.current(token.Key(), limit)
+	u.requests++
+	u.amount += token.Price
+	t.lock.Unlock()
+	if t.persist != nil {
+		go t.persist(key, 1, token.Price)
+	}
+}
+
+// current 需持有 t.lock
+func (t *Tracker) current(token ai.TokenKey, limit config.TokenBudget) (*usage, usageKey) {
+	key := usageKey{token: token, period: periodOf(limit.Period, t.now())}
+	u, ok := t.usage[key]
+	if !ok {
+		u = &usage{}
+		t.usage[key] = u
+	}
+	return u, key
+}
+
+// sync 用 MySQL 中的用量覆盖内存计数，只增不减，并清理过期周期
+func (t *Tracker) sync() error {
+	t.lock.Lock()
+	limited := len(t.limits) > 0
+	t.lock.Unlock()
+	if !limited {
+		return nil
+	}
+	now := t.now()
+	periods := map[string]struct{}{
+		periodOf(config.BudgetPeriodDay, now):   {},
+		periodOf(config.BudgetPeriodMonth, now): {},
+	}
+	keys := make([]string, 0, len(periods))
+	for k := range periods {
+		keys = append(keys, k)
+	}
+	rows := make([]model.TokenUsage, 0)
+	err := mysql.DB.Model(&model.TokenUsage{}).Where("period IN ?", keys).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for k := range t.usage {
+		if _, ok := periods[k.period]; !ok {
+			delete(t.usage, k)
+		}
+	}
+	for _, v := range rows {
+		key := usageKey{token: ai.TokenKey{Supplier: consts.ModelSupplier(v.Supplier), Desc: v.TokenDesc}, period: v.Period}
+		limit, ok := t.limits[key.token]
+		if !ok || periodOf(limit.Period, now) != v.Period {
+			continue
+		}
+		u, _ := t.current(key.token, limit)
+		if v.Requests > u.requests {
+			u.requests = v.Requests
+		}
+		if v.Amount > u.amount {
+			u.amount = v.Amount
+		}
+	}
+	return nil
+}
+
+func persist(key usageKey, requests int, amount float64) {
+	now := time.Now()
+	err := mysql.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":   gorm.Expr("requests + ?", requests),
+			"amount":     gorm.Expr("amount + ?", amount),
+			"updated_at": now,
+		}),
+	}).Create(&model.TokenUsage{
+		Supplier:  key.token.Supplier.String(),
+		TokenDesc: key.token.Desc,
+		Period:    key.period,
+		Requests:  requests,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error
+	if err != nil {
+		logs.Logger.Err(err).Str("supplier", key.token.Supplier.String()).Str("token_desc", key.token.Desc).
+			Msg("Persist token usage error")
+	}
+}
+
+type Remaining struct {
+	Supplier          string    `json:"supplier"`
+	Desc              string    `json:"desc"`
+	Period            string    `json:"period"`
+	ResetAt           time.Time `json:"reset_at"`
+	RequestsLimit     int       `json:"requests_limit"`
+	RequestsUsed      int       `json:"requests_used"`
+	RequestsRemaining int       `json:"requests_remaining"`
+	AmountLimit       float64   `json:"amount_limit"`
+	AmountUsed        float64   `json:"amount_used"`
+	AmountRemaining   float64   `json:"amount_remaining"`
+	Exhausted         bool      `json:"exhausted"`
+}
+
+// Remainings 配置了预算的 token 在当前周期的剩余额度，未限制的项剩余为 0；
+// Exhausted 与 Allow 的判断一致，剩余金额不够再调用一次最便宜的模型即为用尽
+func (t *Tracker) Remainings() []Remaining {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.now()
+	ret := make([]Remaining, 0, len(t.limits))
+	for key, limit := range t.limits {
+		u, _ := t.current(key, limit)
+		r := Remaining{
+			Supplier:      key.Supplier.String(),
+			Desc:          key.Desc,
+			Period:        limit.Period,
+			ResetAt:       resetAt(limit.Period, now),
+			RequestsLimit: limit.Requests,
+			RequestsUsed:  u.requests,
+			AmountLimit:   limit.Amount,
+			AmountUsed:    u.amount,
+		}
+		if limit.Requests > 0 {
+			r.RequestsRemaining = max(limit.Requests-u.requests, 0)
+		}
+		if limit.Amount > 0 {
+			r.AmountRemaining = max(limit.Amount-u.amount, 0)
+		}
+		r.Exhausted = exceeded(limit, u, t.price(key))
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Supplier != ret[j].Supplier {
+			return ret[i].Supplier < ret[j].Supplier
+		}
+		return ret[i].Desc < ret[j].Desc
+	})
+	return ret
+}
+
+func periodOf(period string, now time.Time) string {
+	if period == config.BudgetPeriodMonth {
+		return now.Format("2006-01")
+	}
+	return now.Format("2006-01-02")
+}
+
+func resetAt(period string, now time.Time) time.Time {
+	if period == config.BudgetPeriodMonth {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,56 @@
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker([]config.Token{
+		{Supplier: "tuzi", Desc: "default", Budget: config.TokenBudget{Period: config.BudgetPeriodDay, Requests: 2}},
+		{Supplier: "geek", Desc: "low_price", Budget: config.TokenBudget{Period: config.BudgetPeriodMonth, Amount: 0.1}},
+		{Supplier: "v3", Desc: "default"},
+	})
+	now := time.Date(2026, 10, 18, 23, 0, 0, 0, time.Local)
+	tracker.now = func() time.Time { return now }
+	tracker.price = func(key ai.TokenKey) float64 {
+		if key.Supplier == consts.Geek {
+			return 0.04
+		}
+		return 0
+	}
+
+	tuzi := ai.TokenWithModel{Token: ai.Token{Desc: "default", Supplier: consts.Tuzi}}
+	tracker.Consume(tuzi)
+	require.True(t, tracker.Allow(tuzi))
+	tracker.Consume(tuzi)
+	require.False(t, tracker.Allow(tuzi))
+
+	geek := ai.TokenWithModel{Token: ai.Token{Desc: "low_price", Supplier: consts.Geek}, Price: 0.04}
+	tracker.Consume(geek)
+	tracker.Consume(geek)
+	require.False(t, tracker.Allow(geek))
+
+	v3 := ai.TokenWithModel{Token: ai.Token{Desc: "default", Supplier: consts.V3}}
+	tracker.Consume(v3)
+	require.True(t, tracker.Allow(v3))
+
+	remainings := tracker.Remainings()
+	require.Len(t, remainings, 2)
+	require.Equal(t, "geek", remainings[0].Supplier)
+	require.InDelta(t, 0.02, remainings[0].AmountRemaining, 1e-9)
+	// 剩余 0.02 不够再调用一次，与 Allow 一致视为用尽
+	require.True(t, remainings[0].Exhausted)
+	require.True(t, remainings[1].Exhausted)
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local), remainings[1].ResetAt)
+
+	// 跨天后按日预算重置，按月预算不变
+	now = now.Add(2 * time.Hour)
+	require.True(t, tracker.Allow(tuzi))
+	require.False(t, tracker.Allow(geek))
+}
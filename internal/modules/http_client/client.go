@@ -2,6 +2,7 @@ package http_client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -15,10 +16,17 @@ type HttpClient struct {
 type RequestOption func(options *RequestOptions)
 
 type RequestOptions struct {
+	ctx    context.Context
 	body   any
 	header http.Header
 }
 
+func WithContext(ctx context.Context) RequestOption {
+	return func(c *RequestOptions) {
+		c.ctx = ctx
+	}
+}
+
 func WithBody(body any) RequestOption {
 	return func(c *RequestOptions) {
 		c.body = body
@@ -31,6 +39,14 @@ func WithHeader(key, value string) RequestOption {
 	}
 }
 
+func WithHeaders(headers map[string]string) RequestOption {
+	return func(c *RequestOptions) {
+		for k, v := range headers {
+			c.header.Set(k, v)
+		}
+	}
+}
+
 func New() *HttpClient {
 	return &HttpClient{
 		HttpClient: &http.Client{
@@ -46,7 +62,7 @@ func NewWithTimeout(timeout time.Duration) *HttpClient {
 }
 
 func (c *HttpClient) NewRequest(method string, url string, option ...RequestOption) (*http.Request, error) {
-	options := &RequestOptions{header: http.Header{}}
+	options := &RequestOptions{ctx: context.Background(), header: http.Header{}}
 	for _, opt := range option {
 		opt(options)
 	}
@@ -63,7 +79,7 @@ func (c *HttpClient) NewRequest(method string, url string, option ...RequestOpti
 			body = bytes.NewBuffer(data)
 		}
 	}
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(options.ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,86 @@
+package hub
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	EventStatus   = "status"
+	EventAttempt  = "attempt"
+	EventProgress = "progress"
+
+	subscriberBuffer = 64
+)
+
+type Event struct {
+	Type    string      `json:"type"`
+	TaskId  int         `json:"task_id"`
+	GroupId string      `json:"group_id,omitempty"`
+	Data    interface{} `json:"data"`
+	Time    time.Time   `json:"time"`
+}
+
+// Subscriber 订阅单个任务或整个任务组的事件
+type Subscriber struct {
+	taskId  int
+	groupId string
+	ch      chan Event
+}
+
+func (s *Subscriber) Events() <-chan Event {
+	return s.ch
+}
+
+func (s *Subscriber) match(e Event) bool {
+	if s.taskId != 0 && s.taskId != e.TaskId {
+		return false
+	}
+	if s.groupId != "" && s.groupId != e.GroupId {
+		return false
+	}
+	return true
+}
+
+type Hub struct {
+	lock        sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+var TaskHub = New()
+
+func New() *Hub {
+	return &Hub{subscribers: make(map[*Subscriber]struct{})}
+}
+
+func (h *Hub) Subscribe(taskId int, groupId string) *Subscriber {
+	s := &Subscriber{taskId: taskId, groupId: groupId, ch: make(chan Event, subscriberBuffer)}
+	h.lock.Lock()
+	h.subscribers[s] = struct{}{}
+	h.lock.Unlock()
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.lock.Lock()
+	delete(h.subscribers, s)
+	h.lock.Unlock()
+}
+
+// Publish 不阻塞发布者，订阅者处理不过来时丢弃事件
+func (h *Hub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for s := range h.subscribers {
+		if !s.match(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
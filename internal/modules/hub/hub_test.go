@@ -0,0 +1,38 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := New()
+	byTask := h.Subscribe(1, "")
+	byGroup := h.Subscribe(0, "g1")
+	defer h.Unsubscribe(byGroup)
+
+	h.Publish(Event{Type: EventStatus, TaskId: 1, GroupId: "g1"})
+	h.Publish(Event{Type: EventStatus, TaskId: 2, GroupId: "g1"})
+	h.Publish(Event{Type: EventStatus, TaskId: 3, GroupId: "g2"})
+
+	require.Len(t, byTask.Events(), 1)
+	require.Len(t, byGroup.Events(), 2)
+	e := <-byTask.Events()
+	require.Equal(t, 1, e.TaskId)
+	require.False(t, e.Time.IsZero())
+
+	h.Unsubscribe(byTask)
+	h.Publish(Event{Type: EventStatus, TaskId: 1, GroupId: "g1"})
+	require.Len(t, byTask.Events(), 0)
+	require.Len(t, byGroup.Events(), 3)
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	h := New()
+	s := h.Subscribe(1, "")
+	for i := 0; i < subscriberBuffer+10; i++ {
+		h.Publish(Event{Type: EventProgress, TaskId: 1})
+	}
+	require.Len(t, s.Events(), subscriberBuffer)
+}
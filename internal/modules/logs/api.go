@@ -16,7 +16,7 @@ var (
 
 func InitLogger() {
 	// 从配置中获取日志参数
-	cfg := config.GConfig
+	cfg := config.Get()
 
 	// 设置日志级别
 	level := parseLogLevel(cfg.LogLevel)
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// AdminAudit 管理接口的操作记录
+type AdminAudit struct {
+	Id        int       `json:"id" gorm:"primaryKey"`
+	Action    string    `json:"action" gorm:"column:action;type:varchar(20)"`
+	Model     string    `json:"model" gorm:"column:model;type:varchar(30)"`
+	Supplier  string    `json:"supplier" gorm:"column:supplier;type:varchar(20)"`
+	TokenDesc string    `json:"token_desc" gorm:"column:token_desc;type:varchar(20)"`
+	Params    string    `json:"params" gorm:"column:params;type:varchar(1000)"`
+	Error     string    `json:"error" gorm:"column:error;type:varchar(1000)"`
+	ClientIp  string    `json:"client_ip" gorm:"column:client_ip;type:varchar(50)"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP;index:idx_admin_audit_created"`
+}
+
+func (AdminAudit) TableName() string {
+	return "admin_audit"
+}
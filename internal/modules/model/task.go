@@ -16,9 +16,20 @@ type Task struct {
 	Model        string         `json:"model" gorm:"column:model;type:varchar(30)"`
 	Quality      string         `json:"quality" gorm:"column:quality;type:varchar(20)"`
 	Size         string         `json:"size" gorm:"column:size;type:varchar(20)"`
-	Status       string         `json:"status" gorm:"column:status;type:enum('pending', 'queued', 'running', 'succeed', 'aborted', 'failed')"`
+	Status       string         `json:"status" gorm:"column:status;type:enum('pending', 'queued', 'running', 'succeed', 'aborted', 'failed', 'cancelled');index:idx_task_status"`
 	FailedReason string         `json:"failed_reason" gorm:"column:failed_reason;type:varchar(1000)"`
 	Progress     float32        `json:"progress" gorm:"column:progress;type:float"`
+	Priority     int            `json:"priority" gorm:"column:priority;type:int;default:0"`
+	LeaseOwner   string         `json:"-" gorm:"column:lease_owner;type:varchar(100);default:''"`
+	LeaseExpires sql.NullTime   `json:"-" gorm:"column:lease_expires_at;type:datetime"`
+	CallbackUrl  string         `json:"callback_url" gorm:"column:callback_url;type:varchar(1000)"`
+	Supplier     string         `json:"supplier" gorm:"column:supplier;type:varchar(20)"`   // 仅使用该供应商，为空表示不限制
+	RetryOf      int            `json:"retry_of" gorm:"column:retry_of;type:int;default:0"` // 由该任务重试创建
+	RetryCount   int            `json:"retry_count" gorm:"column:retry_count;type:int;default:0"`
+	Timeout      int            `json:"timeout" gorm:"column:timeout;type:int;default:0"`             // 执行超时秒数，0 表示使用模型默认值
+	CostCap      float64        `json:"cost_cap" gorm:"column:cost_cap;type:decimal(10,4);default:0"` // 单次请求价格上限，0 表示不限制
+	Prefer       string         `json:"prefer" gorm:"column:prefer;type:varchar(20);default:''"`      // cheapest|fastest，为空表示按 request_order 顺序
+	Sticky       bool           `json:"sticky" gorm:"column:sticky;type:tinyint(1);default:0"`        // 优先使用同一任务组上次成功的 token
 	CreatedAt    time.Time      `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
 	UpdatedAt    time.Time      `json:"updated_at" gorm:"column:updated_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
 	TaskImages   []TaskImage    `json:"task_images" gorm:"foreignKey:TaskId"`
@@ -68,18 +79,24 @@ func (t *Task) TidyImage() {
 type TaskStatus string
 
 const (
-	TaskStatusPending TaskStatus = "pending"
-	TaskStatusQueued  TaskStatus = "queued"
-	TaskStatusRunning TaskStatus = "running"
-	TaskStatusAborted TaskStatus = "aborted"
-	TaskStatusSucceed TaskStatus = "succeed"
-	TaskStatusFailed  TaskStatus = "failed"
+	TaskStatusPending   TaskStatus = "pending"
+	TaskStatusQueued    TaskStatus = "queued"
+	TaskStatusRunning   TaskStatus = "running"
+	TaskStatusAborted   TaskStatus = "aborted"
+	TaskStatusSucceed   TaskStatus = "succeed"
+	TaskStatusFailed    TaskStatus = "failed"
+	TaskStatusCancelled TaskStatus = "cancelled"
 )
 
 func (t TaskStatus) String() string {
 	return string(t)
 }
 
+// Finished 任务不会再发生状态变化；aborted 的任务重启后会重新入队
+func (t TaskStatus) Finished() bool {
+	return t == TaskStatusSucceed || t == TaskStatusFailed || t == TaskStatusCancelled
+}
+
 type SupplierInvokeHistory struct {
 	Id             int       `json:"id" gorm:"primaryKey"`
 	TaskId         int       `json:"task_id" gorm:"column:task_id;type:int"`
@@ -90,6 +107,9 @@ type SupplierInvokeHistory struct {
 	FailedRespBody string    `json:"failed_resp_body" gorm:"column:failed_resp_body;type:text"`
 	Error          string    `json:"error" gorm:"column:error;type:varchar(200)"`
 	DurationMs     int64     `json:"duration_ms" gorm:"column:duration_ms;type:int"`
+	Cancelled      bool      `json:"cancelled" gorm:"column:cancelled;type:tinyint(1);not null;default:0"` // 并行请求中其他 token 已成功，本次请求被取消
+	Price          float64   `json:"price" gorm:"column:price;type:decimal(10,4);default:0"`               // 调用时配置的单次价格
+	Run            int       `json:"run" gorm:"column:run;type:int;default:0"`                             // 调用时任务的 retry_count，原地重试后只看当前一轮
 	CreatedAt      time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
 }
 
@@ -97,11 +117,48 @@ func (SupplierInvokeHistory) TableName() string {
 	return "supplier_invoke_history"
 }
 
+// SupplierResult 供应商返回的原始结果，图片下载、保存、上传完成前先落库，失败后可重试
+type SupplierResult struct {
+	Id                int       `json:"id" gorm:"primaryKey"`
+	TaskId            int       `json:"task_id" gorm:"column:task_id;type:int;index:idx_supplier_result_task"`
+	SupplierName      string    `json:"supplier_name" gorm:"column:supplier_name;type:varchar(20)"`
+	TokenDesc         string    `json:"token_desc" gorm:"column:token_desc;type:varchar(20)"`
+	ModelName         string    `json:"model_name" gorm:"column:model_name;type:varchar(30)"`
+	URL               string    `json:"url" gorm:"column:url;type:varchar(2000)"`
+	B64               string    `json:"-" gorm:"column:b64;type:longtext"`
+	Status            string    `json:"status" gorm:"column:status;type:enum('pending', 'processed', 'failed');index:idx_supplier_result_status"`
+	NormalImageId     int       `json:"normal_image_id" gorm:"column:normal_image_id;type:int;default:0"`
+	CompressedImageId int       `json:"compressed_image_id" gorm:"column:compressed_image_id;type:int;default:0"`
+	Attempts          int       `json:"attempts" gorm:"column:attempts;type:int;default:0"`
+	Error             string    `json:"error" gorm:"column:error;type:varchar(1000)"`
+	Run               int       `json:"run" gorm:"column:run;type:int;default:0"` // 暂存时任务的 retry_count
+	NextRetryAt       time.Time `json:"next_retry_at" gorm:"column:next_retry_at;type:datetime"`
+	CreatedAt         time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt         time.Time `json:"updated_at" gorm:"column:updated_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (SupplierResult) TableName() string {
+	return "supplier_result"
+}
+
+type SupplierResultStatus string
+
+const (
+	SupplierResultStatusPending   SupplierResultStatus = "pending"
+	SupplierResultStatusProcessed SupplierResultStatus = "processed"
+	SupplierResultStatusFailed    SupplierResultStatus = "failed"
+)
+
+func (s SupplierResultStatus) String() string {
+	return string(s)
+}
+
 type TaskImage struct {
 	TaskId      int            `json:"task_id" gorm:"column:task_id;type:int"`
 	ImageId     int            `json:"image_id" gorm:"column:image_id;type:int"`
 	Type        string         `json:"type" gorm:"column:type;type:enum('input', 'output')"`     // 类型
 	Origin      sql.NullString `json:"origin" gorm:"column:origin;type:enum('input', 'output')"` // 来源
+	Run         int            `json:"run" gorm:"column:run;type:int;default:0"`                 // 输出图片生成时任务的 retry_count
 	InputImage  InputImage     `json:"input_image" gorm:"foreignKey:ImageId;references:Id"`
 	OutputImage OutputImage    `json:"output_image" gorm:"foreignKey:ImageId;references:Id"`
 }
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// TaskGroupAffinity 任务组在某个模型分类下最近一次成功使用的 token，sticky 任务优先使用
+type TaskGroupAffinity struct {
+	Id            int       `json:"id" gorm:"primaryKey"`
+	TaskGroupId   string    `json:"task_group_id" gorm:"column:task_group_id;type:varchar(50);uniqueIndex:uk_task_group_affinity"`
+	Model         string    `json:"model" gorm:"column:model;type:varchar(30);uniqueIndex:uk_task_group_affinity"` // 模型分类
+	Supplier      string    `json:"supplier" gorm:"column:supplier;type:varchar(20)"`
+	TokenDesc     string    `json:"token_desc" gorm:"column:token_desc;type:varchar(20)"`
+	SupplierModel string    `json:"supplier_model" gorm:"column:supplier_model;type:varchar(50)"` // request_order 中的 model
+	TaskId        int       `json:"task_id" gorm:"column:task_id;type:int"`                       // 最近一次成功的任务
+	CreatedAt     time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"column:updated_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (TaskGroupAffinity) TableName() string {
+	return "task_group_affinity"
+}
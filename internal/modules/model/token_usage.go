@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// TokenUsage token 在一个预算周期内的用量，周期为 2006-01-02（按日）或 2006-01（按月）
+type TokenUsage struct {
+	Id        int       `json:"id" gorm:"primaryKey"`
+	Supplier  string    `json:"supplier" gorm:"column:supplier;type:varchar(20);uniqueIndex:uk_token_usage"`
+	TokenDesc string    `json:"token_desc" gorm:"column:token_desc;type:varchar(20);uniqueIndex:uk_token_usage"`
+	Period    string    `json:"period" gorm:"column:period;type:varchar(10);uniqueIndex:uk_token_usage"`
+	Requests  int       `json:"requests" gorm:"column:requests;type:int;default:0"`
+	Amount    float64   `json:"amount" gorm:"column:amount;type:decimal(12,4);default:0"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (TokenUsage) TableName() string {
+	return "token_usage"
+}
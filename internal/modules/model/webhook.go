@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+)
+
+type WebhookDelivery struct {
+	Id          int       `json:"id" gorm:"primaryKey"`
+	TaskId      int       `json:"task_id" gorm:"column:task_id;type:int;index:idx_webhook_delivery_task"`
+	URL         string    `json:"url" gorm:"column:url;type:varchar(1000)"`
+	Payload     string    `json:"payload" gorm:"column:payload;type:mediumtext"`
+	Status      string    `json:"status" gorm:"column:status;type:enum('pending', 'succeed', 'failed');index:idx_webhook_delivery_status"`
+	Attempts    int       `json:"attempts" gorm:"column:attempts;type:int;default:0"`
+	StatusCode  int       `json:"status_code" gorm:"column:status_code;type:int"`
+	Error       string    `json:"error" gorm:"column:error;type:varchar(1000)"`
+	NextRetryAt time.Time `json:"next_retry_at" gorm:"column:next_retry_at;type:datetime"`
+	LeaseOwner  string    `json:"lease_owner" gorm:"column:lease_owner;type:varchar(100);default:''"` // 最近一次抢占投递的实例
+	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"column:updated_at;type:datetime;not null;default:CURRENT_TIMESTAMP"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceed WebhookDeliveryStatus = "succeed"
+	WebhookDeliveryStatusFailed  WebhookDeliveryStatus = "failed"
+)
+
+func (w WebhookDeliveryStatus) String() string {
+	return string(w)
+}
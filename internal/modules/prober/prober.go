@@ -0,0 +1,246 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/http_client"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/tools"
+)
+
+const (
+	defaultInterval         = time.Minute
+	defaultTimeout          = 10 * time.Second
+	defaultPath             = "v1/models"
+	defaultFailureThreshold = 3
+	defaultBan              = 5 * time.Minute
+)
+
+type settings struct {
+	interval         time.Duration
+	timeout          time.Duration
+	path             string
+	failureThreshold int
+	ban              time.Duration
+}
+
+// newSettings 未配置的字段使用默认值
+func newSettings(p config.Probe) settings {
+	s := settings{
+		interval:         defaultInterval,
+		timeout:          defaultTimeout,
+		path:             defaultPath,
+		failureThreshold: defaultFailureThreshold,
+		ban:              defaultBan,
+	}
+	if d, err := time.ParseDuration(p.Interval); err == nil && d > 0 {
+		s.interval = d
+	}
+	if d, err := time.ParseDuration(p.Timeout); err == nil && d > 0 {
+		s.timeout = d
+	}
+	if p.Path != "" {
+		s.path = p.Path
+	}
+	if p.FailureThreshold > 0 {
+		s.failureThreshold = p.FailureThreshold
+	}
+	if d, err := time.ParseDuration(p.Ban); err == nil && d > 0 {
+		s.ban = d
+	}
+	return s
+}
+
+type Health struct {
+	Supplier            string     `json:"supplier"`
+	Desc                string     `json:"desc"`
+	Healthy             bool       `json:"healthy"`
+	Benched             bool       `json:"benched"` // 因探测失败被熔断
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	StatusCode          int        `json:"status_code,omitempty"`
+	LatencyMs           int64      `json:"latency_ms"`
+	Error               string     `json:"error,omitempty"`
+	LastProbeAt         time.Time  `json:"last_probe_at"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	benchedUntil        time.Time  // 探测设置的熔断截止时间，恢复时只解除截止时间未被改变的熔断
+}
+
+type probeFunc func(ctx context.Context, token config.Token, path string) (int, error)
+
+// Prober 定期探测配置的 token，连续失败时在所有模型下熔断该 token，恢复后解除熔断
+type Prober struct {
+	lock   sync.Mutex
+	health map[ai.TokenKey]*Health
+	probe  probeFunc
+	now    func() time.Time
+}
+
+var GProber *Prober
+
+func New() *Prober {
+	return &Prober{
+		health: make(map[ai.TokenKey]*Health),
+		probe:  probe,
+		now:    time.Now,
+	}
+}
+
+// Init 启动探测，probe.enabled 可通过重新加载配置开启或关闭
+func Init(ctx context.Context) {
+	p := New()
+	GProber = p
+	go func() {
+		for {
+			conf := config.Get()
+			s := newSettings(conf.Probe)
+			if conf.Probe.Enabled {
+				p.round(ctx, conf.Token, s)
+			}
+			select {
+			case <-time.After(s.interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// round 并发探测一轮，并清理已从配置中移除的 token
+func (p *Prober) round(ctx context.Context, tokens []config.Token, s settings) {
+	keys := make(map[ai.TokenKey]struct{})
+	wg := sync.WaitGroup{}
+	for _, v := range tokens {
+		if v.Token == "" {
+			continue
+		}
+		keys[ai.TokenKey{Supplier: consts.ModelSupplier(v.Supplier), Desc: v.Desc}] = struct{}{}
+		wg.Add(1)
+		go func(token config.Token) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+			start := p.now()
+			statusCode, err := p.probe(probeCtx, token, s.path)
+			if ctx.Err() != nil {
+				return
+			}
+			p.record(token, statusCode, p.now().Sub(start), err, s)
+		}(v)
+	}
+	wg.Wait()
+	p.lock.Lock()
+	for k := range p.health {
+		if _, ok := keys[k]; !ok {
+			delete(p.health, k)
+		}
+	}
+	p.lock.Unlock()
+}
+
+func (p *Prober) record(token config.Token, statusCode int, latency time.Duration, err error, s settings) {
+	key := ai.TokenKey{Supplier: consts.ModelSupplier(token.Supplier), Desc: token.Desc}
+	now := p.now()
+	p.lock.Lock()
+	h, ok := p.health[key]
+	if !ok {
+		h = &Health{Supplier: token.Supplier, Desc: token.Desc}
+		p.health[key] = h
+	}
+	h.LastProbeAt = now
+	h.StatusCode = statusCode
+	h.LatencyMs = latency.Milliseconds()
+	h.Healthy = err == nil
+	h.Error = ""
+	var bench, recover bool
+	var benchedUntil time.Time
+	if err != nil {
+		h.Error = err.Error()
+		h.ConsecutiveFailures++
+		// 熔断期间持续失败时延长熔断
+		bench = h.ConsecutiveFailures >= s.failureThreshold
+		if bench {
+			h.Benched = true
+			h.benchedUntil = now.Add(s.ban)
+		}
+	} else {
+		h.ConsecutiveFailures = 0
+		h.LastSuccessAt = &now
+		recover = h.Benched
+		h.Benched = false
+		benchedUntil = h.benchedUntil
+		h.benchedUntil = time.Time{}
+	}
+	failures := h.ConsecutiveFailures
+	until := h.benchedUntil
+	p.lock.Unlock()
+
+	if bench {
+		logs.Logger.Warn().Str("supplier", token.Supplier).Str("token_desc", token.Desc).Int("failures", failures).
+			Err(err).Msg("Token benched by health probe")
+		for _, manager := range ai.TokenManagers() {
+			if manager.Has(key) {
+				// 不缩短手动熔断或余额不足等更长的熔断
+				manager.Extend(ai.Token{Token: token.Token, Desc: token.Desc, Supplier: key.Supplier}, until)
+			}
+		}
+	}
+	if recover {
+		logs.Logger.Info().Str("supplier", token.Supplier).Str("token_desc", token.Desc).Msg("Token recovered by health probe")
+		for _, manager := range ai.TokenManagers() {
+			if manager.Has(key) {
+				manager.Release(key, benchedUntil)
+			}
+		}
+	}
+}
+
+// Health 各 token 最近一次探测结果
+func (p *Prober) Health() []Health {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	ret := make([]Health, 0, len(p.health))
+	for _, v := range p.health {
+		ret = append(ret, *v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Supplier != ret[j].Supplier {
+			return ret[i].Supplier < ret[j].Supplier
+		}
+		return ret[i].Desc < ret[j].Desc
+	})
+	return ret
+}
+
+// probe 使用供应商配置向 path 发送 GET 请求，2xx 表示健康
+func probe(ctx context.Context, token config.Token, path string) (int, error) {
+	supplier := ai.GetSupplier(consts.ModelSupplier(token.Supplier))
+	client := &http_client.HttpClient{HttpClient: supplier.Client(defaultTimeout)}
+	req, err := client.NewRequest(
+		http.MethodGet,
+		tools.FullURL(supplier.BaseURL(), path),
+		http_client.WithContext(ctx),
+		http_client.WithHeaders(supplier.Headers(token.Token)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
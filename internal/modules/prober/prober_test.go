@@ -0,0 +1,66 @@
+package prober
+
+import (
+	"context"
+	"errors"
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProber(t *testing.T) {
+	tuzi := ai.TokenWithModel{Token: ai.Token{Token: "sk-1", Desc: "default", Supplier: consts.Tuzi}, Model: "gpt-4o-image"}
+	geek := ai.TokenWithModel{Token: ai.Token{Token: "sk-2", Desc: "low_price", Supplier: consts.Geek}, Model: "gpt-4o-image"}
+	require.NoError(t, ai.ReloadTokenManager([]string{"gpt-4o-image"}, [][][]ai.TokenWithModel{{{tuzi, geek}}}))
+	manager := ai.GetTokenManager("gpt-4o-image")
+
+	healthy := false
+	p := New()
+	p.probe = func(ctx context.Context, token config.Token, path string) (int, error) {
+		if token.Supplier == consts.Tuzi.String() && !healthy {
+			return 502, errors.New("unexpected status code 502")
+		}
+		return 200, nil
+	}
+	tokens := []config.Token{
+		{Supplier: "tuzi", Token: "sk-1", Desc: "default"},
+		{Supplier: "geek", Token: "sk-2", Desc: "low_price"},
+		{Supplier: "v3", Desc: "default"}, // 未配置 token 不探测
+	}
+	s := settings{timeout: time.Second, failureThreshold: 2, ban: time.Hour}
+
+	p.round(context.Background(), tokens, s)
+	require.Equal(t, "sk-1", manager.GetTokenIterator()().Token.Token)
+	p.round(context.Background(), tokens, s)
+	require.Equal(t, "sk-2", manager.GetTokenIterator()().Token.Token)
+
+	health := p.Health()
+	require.Len(t, health, 2)
+	require.True(t, health[0].Healthy)
+	require.False(t, health[1].Healthy)
+	require.True(t, health[1].Benched)
+	require.Equal(t, 2, health[1].ConsecutiveFailures)
+
+	healthy = true
+	p.round(context.Background(), tokens, s)
+	require.Equal(t, "sk-1", manager.GetTokenIterator()().Token.Token)
+	require.False(t, p.Health()[1].Benched)
+
+	// 恢复时不解除探测之外的熔断
+	healthy = false
+	p.round(context.Background(), tokens, s)
+	p.round(context.Background(), tokens, s)
+	manager.Ban(tuzi.Token, time.Now().Add(24*time.Hour))
+	healthy = true
+	p.round(context.Background(), tokens, s)
+	require.False(t, p.Health()[1].Benched)
+	require.Equal(t, "sk-2", manager.GetTokenIterator()().Token.Token)
+	manager.Unban(tuzi.Key())
+
+	// 从配置中移除的 token 不再展示
+	p.round(context.Background(), tokens[1:], s)
+	require.Len(t, p.Health(), 1)
+}
@@ -2,38 +2,42 @@ package queue
 
 import (
 	"context"
+	"github.com/reusedev/draw-hub/config"
 	"github.com/reusedev/draw-hub/internal/modules/logs"
 	"sync"
+	"time"
 )
 
-var ImageTaskQueue = NewTaskQueue(100)
-var closeOnce sync.Once
+var ImageTaskQueue = NewTaskQueue(0)
 
-func exeImageTask(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
-	for {
+func exeImageTask(ctx context.Context, wg *sync.WaitGroup, pool *workerPool) {
+	defer wg.Done()
+	exit := ctx.Done()
+	// 等待中的任务随等待时间提升优先级，需要定期重新调度
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for !ImageTaskQueue.Closed() || ImageTaskQueue.Len() > 0 || pool.running > 0 {
 		select {
-		case task, ok := <-ImageTaskQueue:
-			if ok {
-				wg.Add(1)
-				go func() {
-					task.Execute(ctx)
-					wg.Done()
-				}()
-			} else {
-				// channel close
-				wg.Done()
-				return
-			}
-		case <-ctx.Done():
-			closeOnce.Do(func() {
-				close(ImageTaskQueue)
-				logs.Logger.Info().Msg("Image task queue closed")
-			})
+		case <-ImageTaskQueue.Notify():
+		case <-ticker.C:
+		case task := <-pool.done:
+			pool.release(task)
+		case <-exit:
+			exit = nil
+			ImageTaskQueue.Close()
+			logs.Logger.Info().Msg("Image task queue closed")
 		}
+		pool.dispatch(ctx, wg, ImageTaskQueue)
 	}
 }
 
-func InitImageTaskQueue(ctx context.Context, wg *sync.WaitGroup) {
-	go exeImageTask(ctx, wg)
+func InitImageTaskQueue(ctx context.Context, wg *sync.WaitGroup, conf config.TaskQueue) {
+	// 配置初始化时已校验
+	var aging time.Duration
+	if conf.AgingInterval != "" {
+		aging, _ = time.ParseDuration(conf.AgingInterval)
+	}
+	ImageTaskQueue = NewTaskQueue(aging)
+	wg.Add(1)
+	go exeImageTask(ctx, wg, newWorkerPool(conf.MaxWorkers, conf.ModelConcurrency))
 }
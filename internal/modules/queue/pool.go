@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool 限制同时执行的任务数，超出全局或单模型上限的任务留在队列中等待空闲槽位
+type workerPool struct {
+	maxWorkers       int
+	modelConcurrency map[string]int
+
+	running      int
+	modelRunning map[string]int
+	done         chan Task
+}
+
+func newWorkerPool(maxWorkers int, modelConcurrency map[string]int) *workerPool {
+	return &workerPool{
+		maxWorkers:       maxWorkers,
+		modelConcurrency: modelConcurrency,
+		modelRunning:     make(map[string]int),
+		done:             make(chan Task),
+	}
+}
+
+func (p *workerPool) full() bool {
+	return p.maxWorkers > 0 && p.running >= p.maxWorkers
+}
+
+func (p *workerPool) acquirable(task Task) bool {
+	if p.full() {
+		return false
+	}
+	limit := p.modelConcurrency[task.Model()]
+	return limit <= 0 || p.modelRunning[task.Model()] < limit
+}
+
+// dispatch 按优先级启动可以获得槽位的任务；ctx 结束后不再限流，让剩余任务尽快退出
+func (p *workerPool) dispatch(ctx context.Context, wg *sync.WaitGroup, q *TaskQueue) {
+	exiting := ctx.Err() != nil
+	if !exiting && p.full() {
+		return
+	}
+	q.take(func(task Task) (bool, bool) {
+		if !exiting && !p.acquirable(task) {
+			return false, p.full()
+		}
+		p.start(ctx, wg, task)
+		return true, !exiting && p.full()
+	})
+}
+
+func (p *workerPool) start(ctx context.Context, wg *sync.WaitGroup, task Task) {
+	if d, ok := task.(Dispatcher); ok {
+		d.Dispatched()
+	}
+	p.running++
+	p.modelRunning[task.Model()]++
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		task.Execute(ctx)
+		p.done <- task
+	}()
+}
+
+func (p *workerPool) release(task Task) {
+	p.running--
+	p.modelRunning[task.Model()]--
+	if p.modelRunning[task.Model()] <= 0 {
+		delete(p.modelRunning, task.Model())
+	}
+}
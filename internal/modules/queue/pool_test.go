@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+type fakeTask struct {
+	id       int
+	model    string
+	priority int
+	started  chan int
+	release  chan struct{}
+}
+
+func (f *fakeTask) Execute(ctx context.Context) {
+	f.started <- f.id
+	<-f.release
+}
+
+func (f *fakeTask) ID() int {
+	return f.id
+}
+
+func (f *fakeTask) Model() string {
+	return f.model
+}
+
+func (f *fakeTask) Priority() int {
+	return f.priority
+}
+
+func TestWorkerPoolLimits(t *testing.T) {
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+	q := NewTaskQueue(0)
+	p := newWorkerPool(3, map[string]int{"midjourney": 1})
+	started := make(chan int, 10)
+	release := make(chan struct{})
+	tasks := []*fakeTask{
+		{id: 1, model: "midjourney"},
+		{id: 2, model: "midjourney"},
+		{id: 3, model: "gpt-image-1"},
+		{id: 4, model: "gpt-image-1"},
+		{id: 5, model: "gpt-image-1"},
+	}
+	for _, task := range tasks {
+		task.started = started
+		task.release = release
+		require.NoError(t, q.Push(task))
+	}
+	p.dispatch(ctx, wg, q)
+	require.Equal(t, 3, p.running)
+	require.Equal(t, 1, p.modelRunning["midjourney"])
+	require.Equal(t, 2, q.Len())
+	position, ok := q.Position(2)
+	require.True(t, ok)
+	require.Equal(t, 1, position)
+
+	release <- struct{}{}
+	p.release(<-p.done)
+	p.dispatch(ctx, wg, q)
+	require.Equal(t, 3, p.running)
+	require.Equal(t, 1, q.Len())
+
+	close(release)
+	for p.running > 0 {
+		p.release(<-p.done)
+		p.dispatch(ctx, wg, q)
+	}
+	wg.Wait()
+	require.Equal(t, 0, q.Len())
+	require.Len(t, started, 5)
+}
+
+func TestWorkerPoolDrainOnExit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	wg := &sync.WaitGroup{}
+	q := NewTaskQueue(0)
+	p := newWorkerPool(1, nil)
+	started := make(chan int, 10)
+	release := make(chan struct{})
+	close(release)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Push(&fakeTask{id: i, model: "gpt-image-1", started: started, release: release}))
+	}
+	q.Close()
+	require.ErrorIs(t, q.Push(&fakeTask{id: 4}), ErrQueueClosed)
+	p.dispatch(ctx, wg, q)
+	require.Equal(t, 0, q.Len())
+	for p.running > 0 {
+		p.release(<-p.done)
+	}
+	wg.Wait()
+	require.Len(t, started, 3)
+}
+
+type dispatchedTask struct {
+	fakeTask
+	dispatched bool
+}
+
+func (d *dispatchedTask) Dispatched() {
+	d.dispatched = true
+}
+
+func TestWorkerPoolDispatched(t *testing.T) {
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+	q := NewTaskQueue(0)
+	p := newWorkerPool(1, nil)
+	started := make(chan int, 2)
+	release := make(chan struct{})
+	first := &dispatchedTask{fakeTask: fakeTask{id: 1, model: "gpt-image-1", started: started, release: release}}
+	second := &dispatchedTask{fakeTask: fakeTask{id: 2, model: "gpt-image-1", started: started, release: release}}
+	require.NoError(t, q.Push(first))
+	require.NoError(t, q.Push(second))
+
+	// 只有离开队列的任务被登记
+	p.dispatch(ctx, wg, q)
+	require.True(t, first.dispatched)
+	require.False(t, second.dispatched)
+
+	close(release)
+	for p.running > 0 {
+		p.release(<-p.done)
+		p.dispatch(ctx, wg, q)
+	}
+	wg.Wait()
+	require.True(t, second.dispatched)
+}
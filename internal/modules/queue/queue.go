@@ -2,14 +2,138 @@ package queue
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
 )
 
+var ErrQueueClosed = errors.New("task queue closed")
+
 type Task interface {
 	Execute(ctx context.Context)
+	ID() int
+	Model() string // 用于单模型并发限制
+	Priority() int // 数值越大越先执行
+}
+
+// Dispatcher 可选，任务离开队列前（仍持有队列锁）调用，使任务在 Execute 之前就能被识别为执行中
+type Dispatcher interface {
+	Dispatched()
+}
+
+type item struct {
+	task       Task
+	enqueuedAt time.Time
+}
+
+// TaskQueue 优先级队列，等待时间每满一个 aging 周期，有效优先级加 1，避免低优先级任务饿死
+type TaskQueue struct {
+	lock   sync.Mutex
+	items  []*item
+	aging  time.Duration
+	closed bool
+	notify chan struct{}
+}
+
+func NewTaskQueue(aging time.Duration) *TaskQueue {
+	return &TaskQueue{
+		aging:  aging,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *TaskQueue) Push(task Task) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.items = append(q.items, &item{task: task, enqueuedAt: time.Now()})
+	q.signal()
+	return nil
+}
+
+func (q *TaskQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
 }
 
-type TaskQueue chan Task
+// Position 返回任务在队列中的位置，从 1 开始
+func (q *TaskQueue) Position(id int) (int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, v := range q.sorted(time.Now()) {
+		if v.task.ID() == id {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func (q *TaskQueue) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.signal()
+	}
+}
+
+func (q *TaskQueue) Closed() bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.closed
+}
+
+// Notify 有任务入队或队列关闭时触发
+func (q *TaskQueue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// take 按有效优先级从高到低遍历，取出 fn 返回 true 的任务；fn 返回 stop 时结束遍历
+func (q *TaskQueue) take(fn func(task Task) (taken, stop bool)) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var remaining []*item
+	sorted := q.sorted(time.Now())
+	for i, v := range sorted {
+		taken, stop := fn(v.task)
+		if !taken {
+			remaining = append(remaining, v)
+		}
+		if stop {
+			remaining = append(remaining, sorted[i+1:]...)
+			break
+		}
+	}
+	q.items = remaining
+}
+
+func (q *TaskQueue) effectivePriority(v *item, now time.Time) int {
+	if q.aging <= 0 {
+		return v.task.Priority()
+	}
+	return v.task.Priority() + int(now.Sub(v.enqueuedAt)/q.aging)
+}
+
+func (q *TaskQueue) sorted(now time.Time) []*item {
+	ret := make([]*item, len(q.items))
+	copy(ret, q.items)
+	sort.SliceStable(ret, func(i, j int) bool {
+		pi, pj := q.effectivePriority(ret[i], now), q.effectivePriority(ret[j], now)
+		if pi != pj {
+			return pi > pj
+		}
+		return ret[i].enqueuedAt.Before(ret[j].enqueuedAt)
+	})
+	return ret
+}
 
-func NewTaskQueue(size int) TaskQueue {
-	return make(TaskQueue, size)
+func (q *TaskQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
 }
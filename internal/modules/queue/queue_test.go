@@ -0,0 +1,37 @@
+package queue
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTaskQueuePriority(t *testing.T) {
+	q := NewTaskQueue(0)
+	require.NoError(t, q.Push(&fakeTask{id: 1, priority: -5}))
+	require.NoError(t, q.Push(&fakeTask{id: 2}))
+	require.NoError(t, q.Push(&fakeTask{id: 3, priority: 5}))
+	require.NoError(t, q.Push(&fakeTask{id: 4}))
+
+	ids := make([]int, 0)
+	q.take(func(task Task) (bool, bool) {
+		ids = append(ids, task.ID())
+		return true, false
+	})
+	require.Equal(t, []int{3, 2, 4, 1}, ids)
+	require.Equal(t, 0, q.Len())
+}
+
+func TestTaskQueueAging(t *testing.T) {
+	q := NewTaskQueue(time.Minute)
+	now := time.Now()
+	q.items = []*item{
+		{task: &fakeTask{id: 1, priority: 2}, enqueuedAt: now},
+		{task: &fakeTask{id: 2, priority: 0}, enqueuedAt: now.Add(-3 * time.Minute)},
+	}
+	position, ok := q.Position(2)
+	require.True(t, ok)
+	require.Equal(t, 1, position)
+	_, ok = q.Position(3)
+	require.False(t, ok)
+}
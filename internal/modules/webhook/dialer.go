@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/modules/http_client"
+	"github.com/reusedev/draw-hub/tools"
+)
+
+// ErrForbiddenAddress callback_url 解析到内网、回环或链路本地地址
+var ErrForbiddenAddress = errors.New("callback address is not allowed")
+
+// guardControl 在建立连接时校验实际连接的 IP，避免 DNS 解析结果变化绕过校验
+func guardControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || tools.InternalIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// newClient 回调使用的 HTTP 客户端，allowPrivate 为 false 时拒绝连接内网地址；不使用环境变量中的代理
+func newClient(timeout time.Duration, allowPrivate bool) *http_client.HttpClient {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = guardControl
+	}
+	return &http_client.HttpClient{
+		HttpClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+			},
+		},
+	}
+}
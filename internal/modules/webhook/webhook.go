@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/modules/http_client"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+)
+
+const (
+	SignatureHeader = "X-Draw-Hub-Signature"
+	TimestampHeader = "X-Draw-Hub-Timestamp"
+	DeliveryHeader  = "X-Draw-Hub-Delivery"
+
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = 10 * time.Second
+	defaultMaxBackoff     = 10 * time.Minute
+	defaultTimeout        = 10 * time.Second
+
+	// pollInterval 定期接手到期未投递的回调，包括宕机实例留下的
+	pollInterval = 30 * time.Second
+	pollBatch    = 100
+)
+
+var (
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryPending  = errors.New("webhook delivery is still pending")
+	ErrDisabled         = errors.New("webhook disabled")
+
+	baseCtx = context.Background()
+	// owner 本实例的标识，投递前写入 lease_owner
+	owner string
+)
+
+// Init 启动回调轮询，接手上次退出时尚未投递完成的回调；多实例部署时通过 claim 保证每次投递只由一个实例执行
+func Init(ctx context.Context) {
+	baseCtx = ctx
+	owner = config.Get().TaskQueue.InstanceId
+	if owner == "" {
+		hostname, _ := os.Hostname()
+		owner = hostname + "-" + uuid.NewString()[:8]
+	}
+	if !config.Get().Webhook.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			pollDeliveries()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func pollDeliveries() {
+	deliveries := make([]model.WebhookDelivery, 0)
+	err := mysql.DB.Model(&model.WebhookDelivery{}).
+		Where("status = ? AND next_retry_at <= ?", model.WebhookDeliveryStatusPending.String(), time.Now()).
+		Order("next_retry_at ASC").Limit(pollBatch).Find(&deliveries).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Load pending webhook deliveries error")
+		return
+	}
+	for i := range deliveries {
+		go deliver(&deliveries[i])
+	}
+}
+
+// claim 抢占一次投递：到期、仍为 pending 且尝试次数未变的记录才能被抢占，
+// 抢占后 next_retry_at 推迟到租约结束，期间其他实例和本实例的轮询都不会重复投递
+func claim(d *model.WebhookDelivery, lease time.Duration) bool {
+	now := time.Now()
+	ret := mysql.DB.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ? AND next_retry_at <= ?",
+			d.Id, model.WebhookDeliveryStatusPending.String(), d.Attempts, now).
+		UpdateColumns(map[string]interface{}{
+			"lease_owner":   owner,
+			"next_retry_at": now.Add(lease),
+		})
+	if ret.Error != nil {
+		logs.Logger.Err(ret.Error).Int("delivery_id", d.Id).Msg("Claim webhook delivery error")
+		return false
+	}
+	return ret.RowsAffected == 1
+}
+
+// Send 记录一次回调并异步投递，失败时按指数退避重试
+func Send(taskId int, url string, payload interface{}) error {
+	if !config.Get().Webhook.Enabled {
+		return ErrDisabled
+	}
+	body, err := jsoniter.MarshalToString(payload)
+	if err != nil {
+		return err
+	}
+	d := model.WebhookDelivery{
+		TaskId:      taskId,
+		URL:         url,
+		Payload:     body,
+		Status:      model.WebhookDeliveryStatusPending.String(),
+		NextRetryAt: retryAt(0),
+	}
+	err = mysql.DB.Model(&model.WebhookDelivery{}).Create(&d).Error
+	if err != nil {
+		return err
+	}
+	go deliver(&d)
+	return nil
+}
+
+// Replay 重新投递一条已结束的回调，重试次数重新计算
+func Replay(id int) error {
+	if !config.Get().Webhook.Enabled {
+		return ErrDisabled
+	}
+	var d model.WebhookDelivery
+	ret := mysql.DB.Model(&model.WebhookDelivery{}).Where("id = ?", id).Find(&d)
+	if ret.Error != nil {
+		return ret.Error
+	}
+	if ret.RowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+	ret = mysql.DB.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status <> ?", id, model.WebhookDeliveryStatusPending.String()).
+		Updates(map[string]interface{}{
+			"status":        model.WebhookDeliveryStatusPending.String(),
+			"attempts":      0,
+			"next_retry_at": retryAt(0),
+		})
+	if ret.Error != nil {
+		return ret.Error
+	}
+	if ret.RowsAffected == 0 {
+		return ErrDeliveryPending
+	}
+	d.Attempts = 0
+	d.NextRetryAt = retryAt(0)
+	go deliver(&d)
+	return nil
+}
+
+func Deliveries(taskId int, status string) ([]model.WebhookDelivery, error) {
+	deliveries := make([]model.WebhookDelivery, 0)
+	query := mysql.DB.Model(&model.WebhookDelivery{})
+	if taskId != 0 {
+		query = query.Where("task_id = ?", taskId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("id DESC").Limit(500).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func Sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff 第 attempt 次失败后的等待时长
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	backoff := initial
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= max {
+			return max
+		}
+	}
+	return min(backoff, max)
+}
+
+// retryAt next_retry_at 列精确到秒，写入时 MySQL 会四舍五入，截断后内存中的值与库中一致，
+// 到期后 claim 不会因为库中的值晚了不到一秒而失败
+func retryAt(after time.Duration) time.Time {
+	return time.Now().Add(after).Truncate(time.Second)
+}
+
+func duration(s string, def time.Duration) time.Duration {
+	// 配置初始化时已校验
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+func deliver(d *model.WebhookDelivery) {
+	conf := config.Get().Webhook
+	maxAttempts := conf.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	initial := duration(conf.InitialBackoff, defaultInitialBackoff)
+	maxBackoff := duration(conf.MaxBackoff, defaultMaxBackoff)
+	timeout := duration(conf.Timeout, defaultTimeout)
+	client := newClient(timeout, conf.AllowPrivateNetwork)
+	for d.Attempts < maxAttempts {
+		if wait := time.Until(d.NextRetryAt); wait > 0 {
+			select {
+			case <-baseCtx.Done():
+				// 保持 pending，由其他实例或下次启动后的轮询继续投递
+				return
+			case <-time.After(wait):
+			}
+		}
+		// 租约覆盖一次投递的超时，实例在投递中宕机时租约到期后由轮询接手
+		if !claim(d, 2*timeout) {
+			return
+		}
+		statusCode, err := post(client, conf.Secret, d)
+		d.Attempts++
+		fields := map[string]interface{}{
+			"attempts":    d.Attempts,
+			"status_code": statusCode,
+			"error":       "",
+		}
+		if err == nil {
+			fields["status"] = model.WebhookDeliveryStatusSucceed.String()
+			update(d, fields)
+			logs.Logger.Info().Int("delivery_id", d.Id).Int("task_id", d.TaskId).Int("attempts", d.Attempts).Msg("Webhook delivered")
+			return
+		}
+		errMsg := err.Error()
+		if len(errMsg) > 1000 {
+			errMsg = errMsg[:1000]
+		}
+		fields["error"] = errMsg
+		logs.Logger.Warn().Err(err).Int("delivery_id", d.Id).Int("task_id", d.TaskId).Int("attempts", d.Attempts).Msg("Webhook delivery failed")
+		if d.Attempts >= maxAttempts {
+			fields["status"] = model.WebhookDeliveryStatusFailed.String()
+			update(d, fields)
+			return
+		}
+		d.NextRetryAt = retryAt(Backoff(d.Attempts, initial, maxBackoff))
+		fields["next_retry_at"] = d.NextRetryAt
+		update(d, fields)
+	}
+}
+
+func post(client *http_client.HttpClient, secret string, d *model.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := client.NewRequest(http.MethodPost, d.URL,
+		http_client.WithContext(baseCtx),
+		http_client.WithBody(bytes.NewBufferString(d.Payload)),
+		http_client.WithHeader("Content-Type", "application/json"),
+		http_client.WithHeader(TimestampHeader, timestamp),
+		http_client.WithHeader(SignatureHeader, Sign(secret, timestamp, d.Payload)),
+		http_client.WithHeader(DeliveryHeader, strconv.Itoa(d.Id)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func update(d *model.WebhookDelivery, fields map[string]interface{}) {
+	err := mysql.DB.Model(&model.WebhookDelivery{}).Where("id = ?", d.Id).Updates(fields).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("delivery_id", d.Id).Msg("Update webhook delivery error")
+	}
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`1700000000.{"id":1}`))
+	expect := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	require.Equal(t, expect, Sign("secret", "1700000000", `{"id":1}`))
+	require.NotEqual(t, expect, Sign("other", "1700000000", `{"id":1}`))
+}
+
+func TestBackoff(t *testing.T) {
+	initial, max := 10*time.Second, time.Minute
+	require.Equal(t, 10*time.Second, Backoff(1, initial, max))
+	require.Equal(t, 20*time.Second, Backoff(2, initial, max))
+	require.Equal(t, 40*time.Second, Backoff(3, initial, max))
+	require.Equal(t, time.Minute, Backoff(4, initial, max))
+	require.Equal(t, time.Minute, Backoff(10, initial, max))
+}
+
+func TestClientRejectsInternalAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := newClient(time.Second, false).HttpClient.Get(srv.URL)
+	require.ErrorIs(t, err, ErrForbiddenAddress)
+
+	resp, err := newClient(time.Second, true).HttpClient.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestRetryAt(t *testing.T) {
+	at := retryAt(time.Minute)
+	require.Zero(t, at.Nanosecond())
+	require.WithinDuration(t, time.Now().Add(time.Minute), at, time.Second)
+}
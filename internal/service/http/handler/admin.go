@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/request"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+)
+
+// ReloadConfig 重新读取配置文件并替换 TokenManager，与 SIGHUP 相同
+func ReloadConfig(c *gin.Context) {
+	err := config.Reload()
+	audit(c, model.AdminAudit{Action: "reload"}, err)
+	if err != nil {
+		logs.Logger.Err(err).Msg("admin-ReloadConfig")
+		c.JSON(http.StatusBadRequest, response.ConfigNotReloadable(err))
+		return
+	}
+	logs.Logger.Info().Msg("Config reloaded")
+	c.JSON(http.StatusOK, response.SuccessWithData(nil))
+}
+
+// AdminTokens 各模型的 token、熔断状态和迭代器数量，可通过 model 参数过滤
+func AdminTokens(c *gin.Context) {
+	m := c.Query("model")
+	ret := make(map[string]ai.ManagerState)
+	for k, manager := range ai.TokenManagers() {
+		if m != "" && k != m {
+			continue
+		}
+		ret[k] = manager.State()
+	}
+	if m != "" && len(ret) == 0 {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(ret))
+}
+
+// AdminTokenAction 手动 ban、unban、drain、disable、enable 一个 token
+func AdminTokenAction(c *gin.Context) {
+	form := request.TokenAction{}
+	if err := c.ShouldBindUri(&form); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	if err := form.Valid(); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	key := ai.TokenKey{Supplier: consts.ModelSupplier(form.Supplier), Desc: form.Desc}
+	managers := make([]*ai.TokenManager, 0)
+	for k, manager := range ai.TokenManagers() {
+		if (form.Model == "" || k == form.Model) && manager.Has(key) {
+			managers = append(managers, manager)
+		}
+	}
+	if len(managers) == 0 {
+		c.JSON(http.StatusBadRequest, response.TokenNotFound)
+		return
+	}
+	for _, manager := range managers {
+		switch form.Action {
+		case request.TokenActionBan:
+			manager.Ban(ai.Token{Supplier: key.Supplier, Desc: key.Desc}, time.Now().Add(time.Duration(form.Duration)*time.Second))
+		case request.TokenActionUnban:
+			manager.Unban(key)
+		case request.TokenActionDrain:
+			manager.Drain(key)
+		case request.TokenActionDisable:
+			manager.Disable(key)
+		case request.TokenActionEnable:
+			manager.Enable(key)
+		}
+	}
+	record := model.AdminAudit{
+		Action:    form.Action,
+		Model:     form.Model,
+		Supplier:  form.Supplier,
+		TokenDesc: form.Desc,
+	}
+	if form.Action == request.TokenActionBan {
+		record.Params = fmt.Sprintf("duration=%d", form.Duration)
+	}
+	audit(c, record, nil)
+	c.JSON(http.StatusOK, response.SuccessWithData(nil))
+}
+
+// AdminAudits 最近的管理操作记录
+func AdminAudits(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, response.ParamError)
+			return
+		}
+		limit = n
+	}
+	query := mysql.DB.Model(&model.AdminAudit{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	audits := make([]model.AdminAudit, 0)
+	err := query.Order("id DESC").Limit(limit).Find(&audits).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("admin-Audits")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(audits))
+}
+
+type ErrorRuleMatch struct {
+	Matched    bool           `json:"matched"`
+	Rule       string         `json:"rule,omitempty"`
+	Action     ai.ErrorAction `json:"action,omitempty"`
+	BanSeconds int            `json:"ban_seconds,omitempty"`
+	Retries    int            `json:"retries,omitempty"`
+}
+
+// TestErrorRule 用样例响应体试运行当前的 error_rules，不产生任何副作用
+func TestErrorRule(c *gin.Context) {
+	form := request.ErrorRuleTest{}
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	if err := form.Valid(); err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	ret := ErrorRuleMatch{}
+	if rule := ai.ClassifyError(form.Supplier, form.Model, form.StatusCode, form.Body); rule != nil {
+		ret.Matched = true
+		ret.Rule = rule.Name
+		ret.Action = rule.Action
+		switch rule.Action {
+		case ai.ErrorActionBanToken, ai.ErrorActionInsufficientBalance:
+			ret.BanSeconds = int(rule.BanDuration().Seconds())
+		case ai.ErrorActionRetry:
+			ret.Retries = rule.MaxRetries()
+		}
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(ret))
+}
+
+func audit(c *gin.Context, record model.AdminAudit, err error) {
+	record.ClientIp = c.ClientIP()
+	record.CreatedAt = time.Now()
+	if err != nil {
+		record.Error = err.Error()
+		if len(record.Error) > 1000 {
+			record.Error = record.Error[:1000]
+		}
+	}
+	logs.Logger.Info().Str("action", record.Action).Str("model", record.Model).Str("supplier", record.Supplier).
+		Str("token_desc", record.TokenDesc).Str("params", record.Params).Str("client_ip", record.ClientIp).
+		Str("error", record.Error).Msg("Admin audit")
+	if err := mysql.DB.Model(&model.AdminAudit{}).Create(&record).Error; err != nil {
+		logs.Logger.Err(err).Msg("Create admin audit error")
+	}
+}
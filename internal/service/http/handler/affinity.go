@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/ai/image"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"gorm.io/gorm/clause"
+)
+
+// affinityOption sticky 任务优先使用同一任务组上次成功的 token，没有记录时返回 nil
+func (h *TaskHandler) affinityOption() ai.IteratorOption {
+	if !h.task.Sticky || h.task.TaskGroupId == "" {
+		return nil
+	}
+	var affinity model.TaskGroupAffinity
+	err := mysql.DB.Model(&model.TaskGroupAffinity{}).
+		Where("task_group_id = ? AND model = ?", h.task.TaskGroupId, h.Model()).
+		Limit(1).Find(&affinity).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Load task group affinity error")
+		return nil
+	}
+	if affinity.Id == 0 {
+		return nil
+	}
+	logs.Logger.Info().Int("task_id", h.task.Id).Str("task_group_id", h.task.TaskGroupId).
+		Str("supplier", affinity.Supplier).Str("token_desc", affinity.TokenDesc).Msg("Task group affinity found")
+	key := ai.TokenKey{Supplier: consts.ModelSupplier(affinity.Supplier), Desc: affinity.TokenDesc}
+	return ai.WithAffinity(key, affinity.SupplierModel)
+}
+
+// saveAffinity 记录 sticky 任务成功使用的 token
+func (h *TaskHandler) saveAffinity(response image.Response) {
+	if !h.task.Sticky || h.task.TaskGroupId == "" {
+		return
+	}
+	now := time.Now()
+	err := mysql.DB.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"supplier", "token_desc", "supplier_model", "task_id", "updated_at"}),
+	}).Create(&model.TaskGroupAffinity{
+		TaskGroupId:   h.task.TaskGroupId,
+		Model:         h.Model(),
+		Supplier:      response.GetSupplier(),
+		TokenDesc:     response.GetTokenDesc(),
+		SupplierModel: response.GetModel(),
+		TaskId:        h.task.Id,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Save task group affinity error")
+	}
+}
@@ -37,13 +37,13 @@ func (s *StorageHandler) Image(fileType string) interface{} {
 	if fileType == "output" {
 		result := s.outputImage
 		if result.URL == "" {
-			result.URL = config.GConfig.LocalStorageDomain + "/" + strings.ReplaceAll(result.Path, string(filepath.Separator), "/")
+			result.URL = config.Get().LocalStorageDomain + "/" + strings.ReplaceAll(result.Path, string(filepath.Separator), "/")
 		}
 		return result
 	}
 	result := s.inputImage
 	if result.URL == "" {
-		result.URL = config.GConfig.LocalStorageDomain + "/" + strings.ReplaceAll(result.Path, string(filepath.Separator), "/")
+		result.URL = config.Get().LocalStorageDomain + "/" + strings.ReplaceAll(result.Path, string(filepath.Separator), "/")
 	}
 	return result
 }
@@ -121,14 +121,14 @@ func (s *StorageHandler) Delete(request request.DeleteImage) error {
 		cloudPath = outputImage.Key
 	}
 	if localPath != "" {
-		p := filepath.Join(config.GConfig.LocalStorageDirectory, localPath)
+		p := filepath.Join(config.Get().LocalStorageDirectory, localPath)
 		local.DeleteFile(p)
 	}
 	if TNLocalPath != "" {
-		p := filepath.Join(config.GConfig.LocalStorageDirectory, TNLocalPath)
+		p := filepath.Join(config.Get().LocalStorageDirectory, TNLocalPath)
 		local.DeleteFile(p)
 	}
-	if cloudPath != "" && config.GConfig.CloudStorageEnabled {
+	if cloudPath != "" && config.Get().CloudStorageEnabled {
 		err := ali.OssClient.Delete(cloudPath)
 		if err != nil {
 			return err
@@ -179,9 +179,9 @@ func (s *StorageHandler) getImageResponse(request request.GetImage) (response.Ge
 		ret.URL = s.outputImage.ModelSupplierURL
 		return ret, nil
 	}
-	if config.GConfig.CloudStorageEnabled && key != "" {
+	if config.Get().CloudStorageEnabled && key != "" {
 		if request.ThumbNail {
-			d, _ := time.ParseDuration(config.GConfig.URLExpires)
+			d, _ := time.ParseDuration(config.Get().URLExpires)
 			ossURL, err := ali.OssClient.Resize50(key, d)
 			if err != nil {
 				return ret, err
@@ -190,7 +190,7 @@ func (s *StorageHandler) getImageResponse(request request.GetImage) (response.Ge
 			return ret, nil
 		}
 		if acl == "private" {
-			d, _ := time.ParseDuration(config.GConfig.URLExpires)
+			d, _ := time.ParseDuration(config.Get().URLExpires)
 			ossURL, err := ali.OssClient.URL(key, d)
 			if err != nil {
 				return ret, err
@@ -204,11 +204,11 @@ func (s *StorageHandler) getImageResponse(request request.GetImage) (response.Ge
 	if request.ThumbNail {
 		if s.outputImage.ThumbNailPath != "" {
 			ret.Path = s.outputImage.ThumbNailPath
-			ret.URL = config.GConfig.LocalStorageDomain + "/" + strings.ReplaceAll(ret.Path, string(filepath.Separator), "/")
+			ret.URL = config.Get().LocalStorageDomain + "/" + strings.ReplaceAll(ret.Path, string(filepath.Separator), "/")
 			return ret, nil
 		}
 	}
-	ret.URL = config.GConfig.LocalStorageDomain + "/" + strings.ReplaceAll(ret.Path, string(filepath.Separator), "/")
+	ret.URL = config.Get().LocalStorageDomain + "/" + strings.ReplaceAll(ret.Path, string(filepath.Separator), "/")
 	return ret, nil
 }
 
@@ -225,19 +225,19 @@ func (s *StorageHandler) initImage(request request.UploadImage) {
 		s.outputImage.CreatedAt = now
 		s.outputImage.Path = s.localOutputStoragePath(fName, now)
 		s.outputImage.Type = "normal"
-		if config.GConfig.CloudStorageEnabled {
+		if config.Get().CloudStorageEnabled {
 			s.outputImage.Key = s.ossStorageKey(fName)
 			s.outputImage.ACL = request.ACL
-			s.outputImage.StorageSupplierName = config.GConfig.CloudStorageSupplier
+			s.outputImage.StorageSupplierName = config.Get().CloudStorageSupplier
 		}
 	} else {
 		s.inputImage.TTL = request.TTL
 		s.inputImage.CreatedAt = now
 		s.inputImage.Path = s.localInputStoragePath(fName, now)
-		if config.GConfig.CloudStorageEnabled {
+		if config.Get().CloudStorageEnabled {
 			s.inputImage.Key = s.ossStorageKey(fName)
 			s.inputImage.ACL = request.ACL
-			s.inputImage.StorageSupplierName = config.GConfig.CloudStorageSupplier
+			s.inputImage.StorageSupplierName = config.Get().CloudStorageSupplier
 		}
 	}
 }
@@ -247,7 +247,7 @@ func (s *StorageHandler) upload(request request.UploadImage) error {
 	if err != nil {
 		return err
 	}
-	if config.GConfig.CloudStorageEnabled {
+	if config.Get().CloudStorageEnabled {
 		err = s.uploadToOSS(request)
 		if err != nil {
 			return err
@@ -285,9 +285,9 @@ func (s *StorageHandler) localSave(request request.UploadImage) error {
 		file = bytes.NewReader(request.OnlineFileContent)
 	}
 	if request.FileType == "output" {
-		absPath = filepath.Join(config.GConfig.LocalStorageDirectory, s.outputImage.Path)
+		absPath = filepath.Join(config.Get().LocalStorageDirectory, s.outputImage.Path)
 	} else {
-		absPath = filepath.Join(config.GConfig.LocalStorageDirectory, s.inputImage.Path)
+		absPath = filepath.Join(config.Get().LocalStorageDirectory, s.inputImage.Path)
 	}
 	err := local.SaveFile(file, absPath)
 	if err != nil {
@@ -308,7 +308,7 @@ func (s *StorageHandler) localOutputStoragePath(filename string, t time.Time) st
 
 func (s *StorageHandler) ossStorageKey(filename string) string {
 	ext := filepath.Ext(filename)
-	key := config.GConfig.AliOss.Directory + uuid.New().String() + ext
+	key := config.Get().AliOss.Directory + uuid.New().String() + ext
 	return key
 }
 
@@ -341,7 +341,7 @@ func (s *StorageHandler) transformToOssUpload(request request.UploadImage) (ali.
 		file = bytes.NewReader(request.OnlineFileContent)
 		fName = request.OnlineFileName
 	}
-	urlExpire, _ := time.ParseDuration(config.GConfig.URLExpires)
+	urlExpire, _ := time.ParseDuration(config.Get().URLExpires)
 	var key, acl string
 	if request.FileType == "output" {
 		key = s.outputImage.Key
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/modules/queue"
+	"gorm.io/gorm"
+)
+
+// 持久化队列：任务以 queued 状态保存在 MySQL 中，各实例通过租约抢占任务，
+// 持有者定期续约，租约过期的任务可被其他实例重新抢占。
+const defaultClaimBatch = 20
+
+var (
+	leaseOwner string
+	leaseTTL   time.Duration
+	// heldTasks 本实例已抢占、尚未执行完成的任务数
+	heldTasks atomic.Int64
+	leaseWake = make(chan struct{}, 1)
+)
+
+func durable() bool {
+	return config.Get().TaskQueue.Durable
+}
+
+func StartDurableQueue(ctx context.Context) {
+	conf := config.Get().TaskQueue
+	leaseOwner = conf.InstanceId
+	if leaseOwner == "" {
+		hostname, _ := os.Hostname()
+		leaseOwner = hostname + "-" + uuid.NewString()[:8]
+	}
+	// 配置初始化时已校验
+	leaseTTL, _ = time.ParseDuration(conf.LeaseTTL)
+	pollInterval, _ := time.ParseDuration(conf.PollInterval)
+	logs.Logger.Info().Str("lease_owner", leaseOwner).Msg("Durable task queue started")
+	go func() {
+		poll := time.NewTicker(pollInterval)
+		defer poll.Stop()
+		heartbeat := time.NewTicker(leaseTTL / 3)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				renewLeases()
+			case <-poll.C:
+				reclaimExpiredLeases()
+				claimTasks()
+			case <-leaseWake:
+				claimTasks()
+			}
+		}
+	}()
+}
+
+func wakeLeaseLoop() {
+	select {
+	case leaseWake <- struct{}{}:
+	default:
+	}
+}
+
+func leaseExpiresExpr() interface{} {
+	return gorm.Expr("DATE_ADD(NOW(), INTERVAL ? SECOND)", int(leaseTTL.Seconds()))
+}
+
+func claimableScope(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ?", model.TaskStatusQueued.String()).
+		Where("lease_owner = '' OR lease_owner IS NULL OR lease_expires_at IS NULL OR lease_expires_at < NOW()")
+}
+
+func claimTasks() {
+	if queue.ImageTaskQueue.Closed() {
+		return
+	}
+	capacity := config.Get().TaskQueue.MaxWorkers
+	if capacity <= 0 {
+		capacity = defaultClaimBatch
+	}
+	free := capacity - int(heldTasks.Load())
+	if free <= 0 {
+		return
+	}
+	query := mysql.DB.Model(&model.Task{}).Scopes(claimableScope)
+	// 配置初始化时已校验
+	if aging, _ := time.ParseDuration(config.Get().TaskQueue.AgingInterval); aging >= time.Second {
+		query = query.Order(fmt.Sprintf("priority + FLOOR(TIMESTAMPDIFF(SECOND, updated_at, NOW()) / %d) DESC", int(aging.Seconds())))
+	} else {
+		query = query.Order("priority DESC")
+	}
+	var ids []int
+	err := query.Order("updated_at ASC").Limit(free).Pluck("id", &ids).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Select claimable tasks error")
+		return
+	}
+	for _, id := range ids {
+		ret := mysql.DB.Model(&model.Task{}).Scopes(claimableScope).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"lease_owner":      leaseOwner,
+			"lease_expires_at": leaseExpiresExpr(),
+		})
+		if ret.Error != nil {
+			logs.Logger.Err(ret.Error).Int("task_id", id).Msg("Claim task error")
+			continue
+		}
+		if ret.RowsAffected == 0 {
+			// 已被其他实例抢占
+			continue
+		}
+		heldTasks.Add(1)
+		var task model.Task
+		err = mysql.DB.Model(&model.Task{}).
+			Preload("TaskImages").
+			Preload("TaskImages.InputImage").
+			Preload("TaskImages.OutputImage").
+			Where("id = ?", id).First(&task).Error
+		h := &TaskHandler{task: &task, alreadyUpdate: make(chan struct{}, 1), leased: true}
+		if err != nil {
+			logs.Logger.Err(err).Int("task_id", id).Msg("Load claimed task error")
+			task.Id = id
+			h.releaseLease()
+			continue
+		}
+		if err = queue.ImageTaskQueue.Push(h); err != nil {
+			h.releaseLease()
+			continue
+		}
+		logs.Logger.Info().Int("task_id", id).Str("lease_owner", leaseOwner).Msg("Claimed task")
+	}
+}
+
+func renewLeases() {
+	err := mysql.DB.Model(&model.Task{}).
+		Where("lease_owner = ? AND status IN ?", leaseOwner, []string{model.TaskStatusQueued.String(), model.TaskStatusRunning.String()}).
+		UpdateColumn("lease_expires_at", leaseExpiresExpr()).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Renew task leases error")
+	}
+	// 在其他实例上被取消的任务
+	var ids []int
+	err = mysql.DB.Model(&model.Task{}).
+		Where("lease_owner = ? AND status = ?", leaseOwner, model.TaskStatusCancelled.String()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Select cancelled tasks error")
+		return
+	}
+	for _, id := range ids {
+		if cancel, ok := runningTasks.Load(id); ok {
+			cancel.(context.CancelCauseFunc)(errTaskCancelled)
+		}
+	}
+}
+
+func expiredLeaseScope(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ? AND lease_owner <> '' AND lease_expires_at < NOW()", model.TaskStatusRunning.String())
+}
+
+// reclaimExpiredLeases 持有者宕机后，其执行中的任务放回队列；供应商已成功返回的任务按恢复流程处理，不再重新请求
+func reclaimExpiredLeases() {
+	tasks := make([]model.Task, 0)
+	err := mysql.DB.Model(&model.Task{}).
+		Preload("TaskImages").
+		Preload("TaskImages.InputImage").
+		Preload("TaskImages.OutputImage").
+		Scopes(expiredLeaseScope).
+		Find(&tasks).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Select expired leases error")
+		return
+	}
+	ids := make([]int, 0, len(tasks))
+	for i := range tasks {
+		h := &TaskHandler{task: &tasks[i], alreadyUpdate: make(chan struct{}, 1)}
+		handled, err := h.recoverSucceeded(model.TaskStatusRunning)
+		if err != nil {
+			logs.Logger.Err(err).Int("task_id", tasks[i].Id).Msg("Recover expired lease error")
+			continue
+		}
+		if !handled {
+			ids = append(ids, tasks[i].Id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	ret := mysql.DB.Model(&model.Task{}).
+		Scopes(expiredLeaseScope).
+		Where("id IN ?", ids).
+		UpdateColumns(map[string]interface{}{
+			"status":           model.TaskStatusQueued.String(),
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if ret.Error != nil {
+		logs.Logger.Err(ret.Error).Msg("Reclaim expired leases error")
+		return
+	}
+	if ret.RowsAffected > 0 {
+		logs.Logger.Warn().Int64("count", ret.RowsAffected).Msg("Reclaimed tasks with expired lease")
+	}
+}
+
+func (h *TaskHandler) releaseLease() {
+	err := mysql.DB.Model(&model.Task{}).Where("id = ? AND lease_owner = ?", h.task.Id, leaseOwner).UpdateColumns(map[string]interface{}{
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Release task lease error")
+	}
+	heldTasks.Add(-1)
+	wakeLeaseLoop()
+}
+
+// durablePosition 尚未被任何实例抢占的任务，按优先级估算排队位置
+func durablePosition(task model.Task) int {
+	var ahead int64
+	err := mysql.DB.Model(&model.Task{}).Scopes(claimableScope).
+		Where("priority > ? OR (priority = ? AND updated_at < ?)", task.Priority, task.Priority, task.UpdatedAt).
+		Count(&ahead).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", task.Id).Msg("Count tasks ahead error")
+		return 0
+	}
+	return int(ahead) + 1
+}
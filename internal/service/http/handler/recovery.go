@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/modules/queue"
+)
+
+// StartTaskRecovery 进程被强制终止后，queued/running 任务不会再被处理。
+// 启动时及周期性检测长时间未更新的任务，按配置重新入队或标记失败。
+// 需在 EnqueueUnfinishedTask 之前调用，启动检查只处理上次遗留的任务。
+func StartTaskRecovery(ctx context.Context) {
+	conf := config.Get().TaskRecovery
+	if conf.StaleAfter == "" {
+		return
+	}
+	// 配置初始化时已校验
+	staleAfter, _ := time.ParseDuration(conf.StaleAfter)
+	interval, _ := time.ParseDuration(conf.Interval)
+	if !durable() {
+		// 单实例模式下启动时没有执行中的任务，queued/running 的任务都是上次遗留的
+		recoverStaleTasks(0)
+	} else {
+		recoverStaleTasks(staleAfter)
+	}
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				recoverStaleTasks(staleAfter)
+			}
+		}
+	}()
+}
+
+func recoverStaleTasks(staleAfter time.Duration) {
+	tasks := make([]model.Task, 0)
+	err := mysql.DB.Model(&model.Task{}).
+		Preload("TaskImages").
+		Preload("TaskImages.InputImage").
+		Preload("TaskImages.OutputImage").
+		Where("status IN ?", []string{model.TaskStatusQueued.String(), model.TaskStatusRunning.String()}).
+		Where("updated_at < ?", time.Now().Add(-staleAfter)).
+		// 租约有效的任务仍有实例在处理
+		Where("lease_owner = '' OR lease_owner IS NULL OR lease_expires_at IS NULL OR lease_expires_at < NOW()").
+		Find(&tasks).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Select stale tasks error")
+		return
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		// 先查队列：任务离开队列前已登记到 runningTasks，按这个顺序检查不会漏掉刚被取出的任务
+		if _, ok := queue.ImageTaskQueue.Position(task.Id); ok {
+			continue
+		}
+		if _, ok := runningTasks.Load(task.Id); ok {
+			continue
+		}
+		h := &TaskHandler{task: task, alreadyUpdate: make(chan struct{}, 1)}
+		err = h.recover()
+		if err != nil {
+			logs.Logger.Err(err).Int("task_id", task.Id).Msg("Recover stale task error")
+		}
+	}
+}
+
+func (h *TaskHandler) recover() error {
+	from := []model.TaskStatus{model.TaskStatusQueued, model.TaskStatusRunning}
+	handled, err := h.recoverSucceeded(from...)
+	if err != nil || handled {
+		return err
+	}
+	if config.Get().TaskRecovery.Policy == config.RecoveryPolicyFail {
+		ok, err := h.transition(model.TaskStatusFailed, map[string]interface{}{
+			"failed_reason": "任务执行中断，请稍后重试",
+		}, from...)
+		if ok {
+			h.callback()
+		}
+		logs.Logger.Warn().Int("task_id", h.task.Id).Msg("Stale task marked as failed")
+		return err
+	}
+	ok, err := h.transition(model.TaskStatusQueued, map[string]interface{}{
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	}, from...)
+	if err != nil || !ok {
+		return err
+	}
+	logs.Logger.Warn().Int("task_id", h.task.Id).Msg("Re-enqueued stale task")
+	if durable() {
+		wakeLeaseLoop()
+		return nil
+	}
+	return queue.ImageTaskQueue.Push(h)
+}
+
+// recoverSucceeded 供应商已成功返回的任务不再重新请求，避免重复计费：有暂存结果时交给结果处理器，
+// 否则按是否已保存输出图片标记成功或失败。返回 false 表示供应商未成功，需要重新执行
+func (h *TaskHandler) recoverSucceeded(from ...model.TaskStatus) (bool, error) {
+	upstreamSucceed, err := h.upstreamSucceed()
+	if err != nil || !upstreamSucceed {
+		return false, err
+	}
+	pending, err := h.hasPendingResults()
+	if err != nil {
+		return false, err
+	}
+	if pending {
+		// 由结果处理器继续处理
+		return true, nil
+	}
+	if h.hasOutputImage() {
+		ok, err := h.transition(model.TaskStatusSucceed, map[string]interface{}{"progress": 100}, from...)
+		if ok {
+			h.callback()
+		}
+		logs.Logger.Warn().Int("task_id", h.task.Id).Msg("Recovered stale task as succeed")
+		return true, err
+	}
+	ok, err := h.transition(model.TaskStatusFailed, map[string]interface{}{
+		"failed_reason": "任务结果处理中断，请稍后重试",
+	}, from...)
+	if ok {
+		h.callback()
+	}
+	logs.Logger.Warn().Int("task_id", h.task.Id).Msg("Stale task already succeeded upstream, marked as failed")
+	return true, err
+}
+
+// upstreamSucceed 只看当前一轮的调用记录，原地重试（requeue）前的成功调用不算
+func (h *TaskHandler) upstreamSucceed() (bool, error) {
+	var count int64
+	err := mysql.DB.Model(&model.SupplierInvokeHistory{}).
+		Where("task_id = ? AND run = ? AND status_code = 200 AND (error = '' OR error IS NULL)", h.task.Id, h.task.RetryCount).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (h *TaskHandler) hasOutputImage() bool {
+	for _, v := range h.task.TaskImages {
+		if v.Type == model.TaskImageTypeOutput.String() && v.Run == h.task.RetryCount {
+			return true
+		}
+	}
+	return false
+}
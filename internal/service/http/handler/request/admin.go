@@ -0,0 +1,53 @@
+package request
+
+import (
+	"fmt"
+)
+
+const (
+	TokenActionBan     = "ban"
+	TokenActionUnban   = "unban"
+	TokenActionDrain   = "drain"
+	TokenActionDisable = "disable"
+	TokenActionEnable  = "enable"
+
+	BanDurationMax = 7 * 24 * 3600
+)
+
+type TokenAction struct {
+	Action   string `uri:"action"`
+	Model    string `form:"model"`    // 可选，为空表示所有配置了该 token 的模型
+	Supplier string `form:"supplier"` // 必填
+	Desc     string `form:"desc"`     // 必填
+	Duration int    `form:"duration"` // ban 的秒数
+}
+
+func (t *TokenAction) Valid() error {
+	switch t.Action {
+	case TokenActionBan:
+		if t.Duration <= 0 || t.Duration > BanDurationMax {
+			return fmt.Errorf("invalid duration: %d, must be between 1 and %d", t.Duration, BanDurationMax)
+		}
+	case TokenActionUnban, TokenActionDrain, TokenActionDisable, TokenActionEnable:
+	default:
+		return fmt.Errorf("invalid action: %s", t.Action)
+	}
+	if t.Supplier == "" || t.Desc == "" {
+		return fmt.Errorf("supplier and desc are required")
+	}
+	return nil
+}
+
+type ErrorRuleTest struct {
+	Supplier   string `form:"supplier"`
+	Model      string `form:"model"` // 供应商模型，即 request_order 中的 model
+	StatusCode int    `form:"status_code"`
+	Body       string `form:"body"` // 供应商返回的响应体样例
+}
+
+func (e *ErrorRuleTest) Valid() error {
+	if e.StatusCode < 100 || e.StatusCode > 599 {
+		return fmt.Errorf("invalid status_code: %d", e.StatusCode)
+	}
+	return nil
+}
@@ -1,7 +1,21 @@
 package request
 
 import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/reusedev/draw-hub/config"
 	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/tools"
+)
+
+const (
+	PriorityMin = -10
+	PriorityMax = 10
+	TimeoutMax  = 3600
 )
 
 type TaskForm interface {
@@ -14,14 +28,43 @@ type TaskForm interface {
 	GetQuality() string
 	GetSize() string
 	GetTaskType() string
+	GetPriority() int
+	GetCallbackUrl() string
+	GetTimeout() int
+	GetCostCap() float64
+	GetPrefer() string
+	GetSticky() bool
+	Valid() error
+}
+
+func validCallbackUrl(callbackUrl string) error {
+	if callbackUrl == "" {
+		return nil
+	}
+	if !config.Get().Webhook.Enabled {
+		return fmt.Errorf("callback_url is not supported: webhook disabled")
+	}
+	u, err := url.Parse(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback_url: %s", callbackUrl)
+	}
+	// 域名解析到的地址在投递连接时校验
+	if !config.Get().Webhook.AllowPrivateNetwork {
+		host := u.Hostname()
+		if ip := net.ParseIP(host); (ip != nil && tools.InternalIP(ip)) || strings.EqualFold(host, "localhost") {
+			return fmt.Errorf("callback_url must not target an internal address: %s", callbackUrl)
+		}
+	}
+	return nil
 }
 
 type SlowTask struct {
-	ImageType string `form:"image_type"`
-	GroupId   string `form:"group_id"`
-	ImageId   int    `form:"image_id"`
-	ImageIds  []int  `form:"image_ids"`
-	Prompt    string `form:"prompt"`
+	ImageType   string `form:"image_type"`
+	GroupId     string `form:"group_id"`
+	ImageId     int    `form:"image_id"`
+	ImageIds    []int  `form:"image_ids"`
+	Prompt      string `form:"prompt"`
+	CallbackUrl string `form:"callback_url"` // 任务结束后回调地址
 }
 
 func (s *SlowTask) GetImageOrigin() string {
@@ -54,6 +97,27 @@ func (s *SlowTask) GetSize() string {
 func (s *SlowTask) GetSpeed() consts.TaskSpeed {
 	return consts.SlowSpeed
 }
+func (s *SlowTask) GetPriority() int {
+	return 0
+}
+func (s *SlowTask) GetCallbackUrl() string {
+	return s.CallbackUrl
+}
+func (s *SlowTask) GetTimeout() int {
+	return 0
+}
+func (s *SlowTask) GetCostCap() float64 {
+	return 0
+}
+func (s *SlowTask) GetPrefer() string {
+	return ""
+}
+func (s *SlowTask) GetSticky() bool {
+	return false
+}
+func (s *SlowTask) Valid() error {
+	return validCallbackUrl(s.CallbackUrl)
+}
 func (s *SlowTask) GetTaskType() string {
 	if len(s.ImageIds) != 0 || s.ImageId != 0 {
 		return consts.TaskTypeEdit.String()
@@ -62,13 +126,14 @@ func (s *SlowTask) GetTaskType() string {
 }
 
 type FastSpeed struct {
-	ImageType string `form:"image_type"`
-	GroupId   string `form:"group_id"`
-	ImageId   int    `form:"image_id"`
-	ImageIds  []int  `form:"image_ids"`
-	Prompt    string `form:"prompt"`
-	Quality   string `form:"quality"`
-	Size      string `form:"size"`
+	ImageType   string `form:"image_type"`
+	GroupId     string `form:"group_id"`
+	ImageId     int    `form:"image_id"`
+	ImageIds    []int  `form:"image_ids"`
+	Prompt      string `form:"prompt"`
+	Quality     string `form:"quality"`
+	Size        string `form:"size"`
+	CallbackUrl string `form:"callback_url"` // 任务结束后回调地址
 }
 
 func (s *FastSpeed) GetImageOrigin() string {
@@ -101,6 +166,27 @@ func (s *FastSpeed) GetSize() string {
 func (s *FastSpeed) GetSpeed() consts.TaskSpeed {
 	return consts.FastSpeed
 }
+func (s *FastSpeed) GetPriority() int {
+	return 0
+}
+func (s *FastSpeed) GetCallbackUrl() string {
+	return s.CallbackUrl
+}
+func (s *FastSpeed) GetTimeout() int {
+	return 0
+}
+func (s *FastSpeed) GetCostCap() float64 {
+	return 0
+}
+func (s *FastSpeed) GetPrefer() string {
+	return ""
+}
+func (s *FastSpeed) GetSticky() bool {
+	return false
+}
+func (s *FastSpeed) Valid() error {
+	return validCallbackUrl(s.CallbackUrl)
+}
 func (s *FastSpeed) GetTaskType() string {
 	if len(s.ImageIds) != 0 || s.ImageId != 0 {
 		return consts.TaskTypeEdit.String()
@@ -109,8 +195,9 @@ func (s *FastSpeed) GetTaskType() string {
 }
 
 type Generate struct {
-	GroupId string `form:"group_id"`
-	Prompt  string `form:"prompt"`
+	GroupId     string `form:"group_id"`
+	Prompt      string `form:"prompt"`
+	CallbackUrl string `form:"callback_url"` // 任务结束后回调地址
 }
 
 func (g *Generate) GetImageOrigin() string {
@@ -138,17 +225,63 @@ func (g *Generate) GetSpeed() consts.TaskSpeed {
 	// use gpt-4o-image or gpt-4o-image-vip model
 	return consts.SlowSpeed
 }
+func (g *Generate) GetPriority() int {
+	return 0
+}
+func (g *Generate) GetCallbackUrl() string {
+	return g.CallbackUrl
+}
+func (g *Generate) GetTimeout() int {
+	return 0
+}
+func (g *Generate) GetCostCap() float64 {
+	return 0
+}
+func (g *Generate) GetPrefer() string {
+	return ""
+}
+func (g *Generate) GetSticky() bool {
+	return false
+}
+func (g *Generate) Valid() error {
+	return validCallbackUrl(g.CallbackUrl)
+}
 func (g *Generate) GetTaskType() string {
 	return consts.TaskTypeGenerate.String()
 }
 
 type Create struct {
-	Model     string `form:"model"`
-	ImageType string `form:"image_type"`
-	GroupId   string `form:"group_id"`
-	ImageIds  []int  `form:"image_ids"`
-	Prompt    string `form:"prompt"`
-	Size      string `form:"size"`
+	Model       string  `form:"model"`
+	ImageType   string  `form:"image_type"`
+	GroupId     string  `form:"group_id"`
+	ImageIds    []int   `form:"image_ids"`
+	Prompt      string  `form:"prompt"`
+	Size        string  `form:"size"`
+	Priority    int     `form:"priority"`     // 优先级，范围 -10 ~ 10，越大越先执行
+	CallbackUrl string  `form:"callback_url"` // 任务结束后回调地址
+	Timeout     int     `form:"timeout"`      // 执行超时秒数，0 表示使用模型默认值
+	CostCap     float64 `form:"cost_cap"`     // 单次请求价格上限，0 表示不限制；设置后跳过未配置价格的 token
+	Prefer      string  `form:"prefer"`       // cheapest|fastest，为空表示按 request_order 顺序
+	Sticky      bool    `form:"sticky"`       // 优先使用同一 group_id 上次成功的供应商和 token
+}
+
+func (c *Create) Valid() error {
+	if c.Priority < PriorityMin || c.Priority > PriorityMax {
+		return fmt.Errorf("invalid priority: %d, must be between %d and %d", c.Priority, PriorityMin, PriorityMax)
+	}
+	if c.Timeout < 0 || c.Timeout > TimeoutMax {
+		return fmt.Errorf("invalid timeout: %d, must be between 0 and %d", c.Timeout, TimeoutMax)
+	}
+	if c.CostCap < 0 {
+		return fmt.Errorf("invalid cost_cap: %v, must be non-negative", c.CostCap)
+	}
+	if err := ai.Prefer(c.Prefer).Valid(); err != nil {
+		return err
+	}
+	if c.Sticky && c.GroupId == "" {
+		return fmt.Errorf("group_id is required when sticky is set")
+	}
+	return validCallbackUrl(c.CallbackUrl)
 }
 
 func (c *Create) GetImageOrigin() string {
@@ -184,3 +317,46 @@ func (c *Create) GetTaskType() string {
 	}
 	return consts.TaskTypeGenerate.String()
 }
+func (c *Create) GetPriority() int {
+	return c.Priority
+}
+func (c *Create) GetCallbackUrl() string {
+	return c.CallbackUrl
+}
+func (c *Create) GetTimeout() int {
+	return c.Timeout
+}
+func (c *Create) GetCostCap() float64 {
+	return c.CostCap
+}
+func (c *Create) GetPrefer() string {
+	return c.Prefer
+}
+func (c *Create) GetSticky() bool {
+	return c.Sticky
+}
+
+const (
+	RetryModeClone   = "clone"
+	RetryModeRequeue = "requeue"
+)
+
+type Retry struct {
+	Id       int    `form:"id"`
+	Mode     string `form:"mode"`     // clone（默认）复制为新任务；requeue 原任务重新入队
+	Model    string `form:"model"`    // 可选，使用其他模型
+	Supplier string `form:"supplier"` // 可选，仅使用该供应商
+}
+
+func (r *Retry) Valid() error {
+	if r.Id <= 0 {
+		return fmt.Errorf("invalid id: %d", r.Id)
+	}
+	if r.Mode == "" {
+		r.Mode = RetryModeClone
+	}
+	if r.Mode != RetryModeClone && r.Mode != RetryModeRequeue {
+		return fmt.Errorf("invalid mode: %s", r.Mode)
+	}
+	return nil
+}
@@ -7,6 +7,24 @@ var (
 
 	InternalError = gin.H{"code": 10002, "message": "internal error"}
 
+	TaskNotCancelable = gin.H{"code": 10003, "message": "task not found or already finished"}
+
+	DeliveryNotReplayable = gin.H{"code": 10004, "message": "webhook delivery not found or still pending"}
+
+	TaskNotRetryable = gin.H{"code": 10005, "message": "task not found or not failed"}
+
+	ConfigNotReloadable = func(err error) gin.H {
+		return gin.H{"code": 10006, "message": err.Error()}
+	}
+
+	AdminDisabled = gin.H{"code": 10007, "message": "admin api disabled"}
+
+	Unauthorized = gin.H{"code": 10008, "message": "unauthorized"}
+
+	TokenNotFound = gin.H{"code": 10009, "message": "token not found"}
+
+	ModelNotSupported = gin.H{"code": 10010, "message": "model not supported"}
+
 	SuccessWithData = func(data interface{}) gin.H {
 		return gin.H{"code": 0, "data": data}
 	}
@@ -0,0 +1,15 @@
+package response
+
+type TaskPosition struct {
+	TaskId   int    `json:"task_id"`
+	Status   string `json:"status"`
+	Priority int    `json:"priority"`
+	Position int    `json:"position"` // 排队位置，从 1 开始；不在队列中时为 0
+}
+
+// TaskStatus 任务状态变化事件
+type TaskStatus struct {
+	Status       string  `json:"status"`
+	FailedReason string  `json:"failed_reason,omitempty"`
+	Progress     float32 `json:"progress,omitempty"`
+}
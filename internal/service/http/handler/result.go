@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/modules/ai/image"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/tools"
+)
+
+const (
+	defaultPostProcessAttempts = 5
+	defaultPostProcessInterval = time.Minute
+	// processingLease 处理中的结果在该时长内不会被其他实例重复处理
+	processingLease     = 10 * time.Minute
+	resultProcessorTick = 30 * time.Second
+)
+
+// stageResults 保存供应商返回的图片地址和 base64，每张图片一条记录
+func (h *TaskHandler) stageResults(resp image.Response) error {
+	results := make([]model.SupplierResult, 0)
+	now := time.Now()
+	newResult := func() model.SupplierResult {
+		return model.SupplierResult{
+			TaskId:       h.task.Id,
+			SupplierName: resp.GetSupplier(),
+			TokenDesc:    resp.GetTokenDesc(),
+			ModelName:    resp.GetModel(),
+			Status:       model.SupplierResultStatusPending.String(),
+			Run:          h.task.RetryCount,
+			NextRetryAt:  now,
+		}
+	}
+	for _, v := range resp.GetURLs() {
+		r := newResult()
+		r.URL = v
+		results = append(results, r)
+	}
+	for _, v := range resp.GetB64s() {
+		r := newResult()
+		r.B64 = v
+		results = append(results, r)
+	}
+	return mysql.DB.Model(&model.SupplierResult{}).Create(&results).Error
+}
+
+// processResults 处理任务待处理的结果，全部处理完成后更新任务状态
+func (h *TaskHandler) processResults() error {
+	results := make([]model.SupplierResult, 0)
+	err := mysql.DB.Model(&model.SupplierResult{}).
+		Where("task_id = ? AND run = ? AND status = ? AND next_retry_at <= ?", h.task.Id, h.task.RetryCount,
+			model.SupplierResultStatusPending.String(), time.Now()).
+		Find(&results).Error
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		if !claimResult(&results[i]) {
+			continue
+		}
+		h.processResult(&results[i])
+	}
+	return h.finishResults()
+}
+
+func claimResult(r *model.SupplierResult) bool {
+	now := time.Now()
+	ret := mysql.DB.Model(&model.SupplierResult{}).
+		Where("id = ? AND status = ? AND next_retry_at <= ?", r.Id, model.SupplierResultStatusPending.String(), now).
+		UpdateColumn("next_retry_at", now.Add(processingLease))
+	if ret.Error != nil {
+		logs.Logger.Err(ret.Error).Int("result_id", r.Id).Msg("Claim supplier result error")
+		return false
+	}
+	return ret.RowsAffected == 1
+}
+
+// processResult 下载 → 保存 → 缩略图 → 压缩 → 上传，已完成的步骤重试时跳过
+func (h *TaskHandler) processResult(r *model.SupplierResult) {
+	b, err := resultBytes(r)
+	if err == nil && r.NormalImageId == 0 {
+		r.NormalImageId, err = h.createNormalRecord(b, r)
+		if err == nil {
+			err = updateResult(r, map[string]interface{}{"normal_image_id": r.NormalImageId})
+		}
+	}
+	if err == nil && r.CompressedImageId == 0 {
+		r.CompressedImageId, err = h.createCompressionRecord(b, r)
+		if err == nil {
+			err = updateResult(r, map[string]interface{}{"compressed_image_id": r.CompressedImageId})
+		}
+	}
+	if err == nil {
+		err = updateResult(r, map[string]interface{}{
+			"status": model.SupplierResultStatusProcessed.String(),
+			"error":  "",
+		})
+		if err == nil {
+			return
+		}
+	}
+
+	conf := config.Get().PostProcess
+	maxAttempts := conf.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultPostProcessAttempts
+	}
+	// 配置初始化时已校验
+	interval, _ := time.ParseDuration(conf.RetryInterval)
+	if interval <= 0 {
+		interval = defaultPostProcessInterval
+	}
+	r.Attempts++
+	errMsg := err.Error()
+	if len(errMsg) > 1000 {
+		errMsg = errMsg[:1000]
+	}
+	fields := map[string]interface{}{
+		"attempts":      r.Attempts,
+		"error":         errMsg,
+		"next_retry_at": time.Now().Add(interval * time.Duration(r.Attempts)),
+	}
+	if r.Attempts >= maxAttempts {
+		fields["status"] = model.SupplierResultStatusFailed.String()
+	}
+	logs.Logger.Warn().Err(err).Int("task_id", h.task.Id).Int("result_id", r.Id).Int("attempts", r.Attempts).
+		Msg("Process supplier result error")
+	updateResult(r, fields)
+}
+
+func (h *TaskHandler) finishResults() error {
+	var stats []struct {
+		Status    string
+		ModelName string
+		Count     int
+	}
+	err := mysql.DB.Model(&model.SupplierResult{}).Select("status, MAX(model_name) AS model_name, COUNT(*) AS count").
+		Where("task_id = ? AND run = ?", h.task.Id, h.task.RetryCount).Group("status").Scan(&stats).Error
+	if err != nil {
+		return err
+	}
+	var pending, processed int
+	var modelName string
+	for _, v := range stats {
+		switch v.Status {
+		case model.SupplierResultStatusPending.String():
+			pending = v.Count
+		case model.SupplierResultStatusProcessed.String():
+			processed = v.Count
+			modelName = v.ModelName
+		}
+	}
+	if pending > 0 {
+		// 等待后台重试
+		logs.Logger.Info().Int("task_id", h.task.Id).Int("pending", pending).Msg("Supplier results waiting for retry")
+		return nil
+	}
+	if processed == 0 {
+		ok, err := h.transition(model.TaskStatusFailed, map[string]interface{}{
+			"failed_reason": "图片处理失败，请稍后重试",
+		}, model.TaskStatusRunning)
+		if ok {
+			h.callback()
+		}
+		logs.Logger.Error().Int("task_id", h.task.Id).Str("status", "failed").Msg("Process supplier results failed")
+		return err
+	}
+	fields := map[string]interface{}{
+		"progress": 100,
+	}
+	if h.task.Model == "" {
+		fields["model"] = modelName
+	}
+	ok, err := h.transition(model.TaskStatusSucceed, fields, model.TaskStatusRunning)
+	if err != nil {
+		return err
+	}
+	if ok {
+		h.callback()
+	}
+	// 记录任务成功完成日志
+	logs.Logger.Info().
+		Int("task_id", h.task.Id).
+		Str("model", modelName).
+		Str("status", "success").
+		Int("images", processed).
+		Msg("Task completed successfully")
+	return nil
+}
+
+func (h *TaskHandler) hasPendingResults() (bool, error) {
+	var count int64
+	err := mysql.DB.Model(&model.SupplierResult{}).
+		Where("task_id = ? AND run = ? AND status = ?", h.task.Id, h.task.RetryCount, model.SupplierResultStatusPending.String()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func resultBytes(r *model.SupplierResult) ([]byte, error) {
+	if r.URL != "" {
+		b, _, err := tools.GetOnlineImage(r.URL)
+		return b, err
+	}
+	return base64.StdEncoding.DecodeString(r.B64)
+}
+
+func updateResult(r *model.SupplierResult, fields map[string]interface{}) error {
+	err := mysql.DB.Model(&model.SupplierResult{}).Where("id = ?", r.Id).Updates(fields).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("result_id", r.Id).Msg("Update supplier result error")
+	}
+	return err
+}
+
+// StartResultProcessor 周期性重试处理失败的结果
+func StartResultProcessor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(resultProcessorTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				retryResults()
+			}
+		}
+	}()
+}
+
+func retryResults() {
+	var taskIds []int
+	err := mysql.DB.Model(&model.SupplierResult{}).
+		Joins("JOIN task ON task.id = supplier_result.task_id").
+		Where("supplier_result.status = ? AND supplier_result.next_retry_at <= ?", model.SupplierResultStatusPending.String(), time.Now()).
+		Where("task.status = ? AND supplier_result.run = task.retry_count", model.TaskStatusRunning.String()).
+		Distinct().Pluck("supplier_result.task_id", &taskIds).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("Select pending supplier results error")
+		return
+	}
+	for _, id := range taskIds {
+		if _, ok := runningTasks.Load(id); ok {
+			continue
+		}
+		h := &TaskHandler{alreadyUpdate: make(chan struct{}, 1)}
+		err = h.reload(id)
+		if err == nil {
+			err = h.processResults()
+		}
+		if err != nil {
+			logs.Logger.Err(err).Int("task_id", id).Msg("Retry supplier results error")
+		}
+	}
+}
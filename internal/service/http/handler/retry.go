@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/request"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+	"gorm.io/gorm"
+)
+
+var (
+	errTaskNotRetryable  = errors.New("task not found or not failed")
+	errInvalidRetryParam = errors.New("invalid retry param")
+)
+
+// retry 使用原任务的输入重新执行，clone 复制为新任务并记录 retry_of，requeue 原任务重新入队
+func (h *TaskHandler) retry(form request.Retry) error {
+	var origin model.Task
+	ret := mysql.DB.Model(&model.Task{}).
+		Preload("TaskImages").
+		Preload("TaskImages.InputImage").
+		Preload("TaskImages.OutputImage").
+		Where("id = ?", form.Id).Find(&origin)
+	if ret.Error != nil {
+		return ret.Error
+	}
+	if ret.RowsAffected == 0 {
+		return errTaskNotRetryable
+	}
+	status := model.TaskStatus(origin.Status)
+	if status != model.TaskStatusFailed && status != model.TaskStatusCancelled {
+		return errTaskNotRetryable
+	}
+	h.task = &origin
+	err := h.applyRetryModel(form.Model)
+	if err != nil {
+		return err
+	}
+	err = h.applyRetrySupplier(form.Supplier)
+	if err != nil {
+		return err
+	}
+	if form.Mode == request.RetryModeRequeue {
+		err = h.requeueTask()
+	} else {
+		err = h.cloneTask()
+	}
+	if err != nil {
+		return err
+	}
+	h.enqueue()
+	logs.Logger.Info().Int("task_id", h.task.Id).Int("origin_task_id", origin.Id).Str("mode", form.Mode).Msg("Task retried")
+	return nil
+}
+
+func (h *TaskHandler) applyRetryModel(m string) error {
+	if m == "" {
+		return nil
+	}
+	if h.task.Speed.Valid {
+		// v1/v2 任务按速度选择模型分类
+		switch {
+		case h.task.Speed.String == consts.SlowSpeed.String() && m == consts.GPT4oImage.String():
+			h.task.Model = ""
+		case h.task.Speed.String == consts.SlowSpeed.String() && m == consts.GPT4oImageVip.String():
+			h.task.Model = m
+		case h.task.Speed.String == consts.FastSpeed.String() && m == consts.GPTImage1.String():
+			h.task.Model = ""
+		default:
+			return fmt.Errorf("%w: model %s not supported for %s task", errInvalidRetryParam, m, h.task.Speed.String)
+		}
+		return nil
+	}
+	if !supportedModel(m) {
+		return fmt.Errorf("%w: model %s not supported", errInvalidRetryParam, m)
+	}
+	h.task.Model = m
+	return nil
+}
+
+func (h *TaskHandler) applyRetrySupplier(supplier string) error {
+	if supplier == "" {
+		return nil
+	}
+	manager := ai.GetTokenManager(h.Model())
+	if manager == nil || !manager.HasSupplier(consts.ModelSupplier(supplier)) {
+		return fmt.Errorf("%w: supplier %s not configured for model %s", errInvalidRetryParam, supplier, h.Model())
+	}
+	h.task.Supplier = supplier
+	return nil
+}
+
+func (h *TaskHandler) cloneTask() error {
+	origin := h.task
+	now := time.Now()
+	taskRecord := model.Task{
+		TaskGroupId: origin.TaskGroupId,
+		Type:        origin.Type,
+		Prompt:      origin.Prompt,
+		Speed:       origin.Speed,
+		Model:       origin.Model,
+		Quality:     origin.Quality,
+		Size:        origin.Size,
+		Status:      model.TaskStatusPending.String(),
+		Priority:    origin.Priority,
+		CallbackUrl: origin.CallbackUrl,
+		Supplier:    origin.Supplier,
+		RetryOf:     origin.Id,
+		Timeout:     origin.Timeout,
+		CostCap:     origin.CostCap,
+		Prefer:      origin.Prefer,
+		Sticky:      origin.Sticky,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err := mysql.DB.Model(&model.Task{}).Create(&taskRecord).Error
+	if err != nil {
+		return err
+	}
+	for _, v := range origin.TaskImages {
+		if v.Type != model.TaskImageTypeInput.String() {
+			continue
+		}
+		taskImageR := model.TaskImage{
+			ImageId: v.ImageId,
+			TaskId:  taskRecord.Id,
+			Type:    model.TaskImageTypeInput.String(),
+			Origin:  v.Origin,
+		}
+		err = mysql.DB.Model(&model.TaskImage{}).Create(&taskImageR).Error
+		if err != nil {
+			return err
+		}
+	}
+	return h.reload(taskRecord.Id)
+}
+
+// requeueTask retry_count 加一开始新的一轮，恢复和结果处理只看本轮的调用记录、暂存结果和输出图片
+func (h *TaskHandler) requeueTask() error {
+	ok, err := h.transition(model.TaskStatusPending, map[string]interface{}{
+		"failed_reason": "",
+		"progress":      0,
+		"model":         h.task.Model,
+		"supplier":      h.task.Supplier,
+		"retry_count":   gorm.Expr("retry_count + 1"),
+	}, model.TaskStatusFailed, model.TaskStatusCancelled)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errTaskNotRetryable
+	}
+	return h.reload(h.task.Id)
+}
+
+func (h *TaskHandler) reload(id int) error {
+	var task model.Task
+	err := mysql.DB.Model(&model.Task{}).
+		Preload("TaskImages").
+		Preload("TaskImages.InputImage").
+		Preload("TaskImages.OutputImage").
+		Where("id = ?", id).First(&task).Error
+	if err != nil {
+		return err
+	}
+	h.task = &task
+	return nil
+}
+
+func Retry(c *gin.Context) {
+	form := request.Retry{}
+	err := c.ShouldBind(&form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	err = form.Valid()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	h, err := newTaskHandler(c)
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-Retry-NewTaskHandler")
+		c.JSON(http.StatusInternalServerError, response.ParamError)
+		return
+	}
+	err = h.retry(form)
+	if errors.Is(err, errTaskNotRetryable) {
+		c.JSON(http.StatusBadRequest, response.TaskNotRetryable)
+		return
+	}
+	if errors.Is(err, errInvalidRetryParam) {
+		logs.Logger.Warn().Err(err).Msg("task-Retry")
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-Retry")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(h.task.TidyImageTask()))
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/internal/modules/hub"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	// streamPoll durable 模式下任务可能由其他实例执行，本实例的 hub 收不到其事件，定期从 MySQL 补发状态变化
+	streamPoll = 2 * time.Second
+)
+
+// TaskStream 通过 SSE 推送任务状态变化、供应商调用和生成进度。
+// 按 id 订阅时任务结束后关闭连接；按 group_id 订阅时由客户端断开。
+// durable 模式下其他实例执行的任务只能轮询到状态和进度，没有供应商调用事件。
+func TaskStream(c *gin.Context) {
+	id := c.Query("id")
+	groupId := c.Query("group_id")
+	if id == "" && groupId == "" {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	var taskId int
+	if id != "" {
+		var err error
+		taskId, err = strconv.Atoi(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.ParamError)
+			return
+		}
+	}
+	// 先订阅再查询当前状态，避免两者之间的状态变化丢失
+	sub := hub.TaskHub.Subscribe(taskId, groupId)
+	defer hub.TaskHub.Unsubscribe(sub)
+	h := TaskHandler{}
+	tasks, err := h.list(groupId, id)
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-TaskStream")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	if taskId != 0 && len(tasks) == 0 {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	// sent 已推送的最新状态，轮询时只补发有变化的任务
+	sent := make(map[int]response.TaskStatus)
+	// sendStatus 返回按 id 订阅的任务是否已结束
+	sendStatus := func(tasks []model.Task) bool {
+		finished := false
+		for _, task := range tasks {
+			status := response.TaskStatus{
+				Status:       task.Status,
+				FailedReason: task.FailedReason,
+				Progress:     task.Progress,
+			}
+			finished = model.TaskStatus(task.Status).Finished()
+			if last, ok := sent[task.Id]; ok && last == status {
+				continue
+			}
+			sent[task.Id] = status
+			c.SSEvent(hub.EventStatus, hub.Event{
+				Type:    hub.EventStatus,
+				TaskId:  task.Id,
+				GroupId: task.TaskGroupId,
+				Data:    status,
+				Time:    task.UpdatedAt,
+			})
+		}
+		return taskId != 0 && finished
+	}
+	finished := sendStatus(tasks)
+	c.Writer.Flush()
+	if finished {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	var poll <-chan time.Time
+	if durable() {
+		ticker := time.NewTicker(streamPoll)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-poll:
+			tasks, err := h.list(groupId, id)
+			if err != nil {
+				logs.Logger.Err(err).Msg("task-TaskStream-Poll")
+				return true
+			}
+			return !sendStatus(tasks)
+		case e := <-sub.Events():
+			c.SSEvent(e.Type, e)
+			if status, ok := e.Data.(response.TaskStatus); ok {
+				sent[e.TaskId] = status
+				if taskId != 0 {
+					return !model.TaskStatus(status.Status).Finished()
+				}
+			}
+			return true
+		}
+	})
+}
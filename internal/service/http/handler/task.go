@@ -4,16 +4,14 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"github.com/reusedev/draw-hub/internal/modules/ai/image/gemini"
-	"github.com/reusedev/draw-hub/internal/modules/ai/image/mj"
-	"github.com/reusedev/draw-hub/internal/modules/ai/image/volc"
 	"github.com/reusedev/draw-hub/internal/modules/observer"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,27 +19,44 @@ import (
 	"github.com/reusedev/draw-hub/config"
 	"github.com/reusedev/draw-hub/internal/components/mysql"
 	"github.com/reusedev/draw-hub/internal/consts"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
 	"github.com/reusedev/draw-hub/internal/modules/ai/image"
-	"github.com/reusedev/draw-hub/internal/modules/ai/image/gpt"
+	_ "github.com/reusedev/draw-hub/internal/modules/ai/image/gemini"
+	_ "github.com/reusedev/draw-hub/internal/modules/ai/image/gpt"
+	_ "github.com/reusedev/draw-hub/internal/modules/ai/image/mj"
+	_ "github.com/reusedev/draw-hub/internal/modules/ai/image/volc"
+	"github.com/reusedev/draw-hub/internal/modules/hub"
 	"github.com/reusedev/draw-hub/internal/modules/logs"
 	"github.com/reusedev/draw-hub/internal/modules/model"
 	"github.com/reusedev/draw-hub/internal/modules/queue"
 	"github.com/reusedev/draw-hub/internal/modules/storage/ali"
 	"github.com/reusedev/draw-hub/internal/modules/storage/local"
+	"github.com/reusedev/draw-hub/internal/modules/webhook"
 	"github.com/reusedev/draw-hub/internal/service/http/handler/request"
 	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
 	"github.com/reusedev/draw-hub/tools"
 )
 
+var (
+	errTaskCancelled = errors.New("task cancelled")
+	errTaskTimeout   = errors.New("task timeout")
+	// runningTasks task id -> context.CancelCauseFunc，用于取消执行中的任务
+	runningTasks sync.Map
+)
+
+const failedReasonTimeout = "timeout"
+
 type TaskHandler struct {
 	ctx           *gin.Context
+	taskCtx       context.Context
 	task          *model.Task
 	imageResponse []image.Response
 	alreadyUpdate chan struct{}
+	leased        bool // 通过持久化队列租约抢占的任务
 }
 
 func newTaskHandler(c *gin.Context) (*TaskHandler, error) {
-	h := &TaskHandler{ctx: c}
+	h := &TaskHandler{ctx: c, alreadyUpdate: make(chan struct{}, 1)}
 	return h, nil
 }
 
@@ -56,7 +71,7 @@ func EnqueueUnfinishedTask() error {
 		return err
 	}
 	for _, task := range tasks {
-		h := TaskHandler{task: &task}
+		h := TaskHandler{task: &task, alreadyUpdate: make(chan struct{}, 1)}
 		h.enqueue()
 		logs.Logger.Info().Int("task_id", task.Id).Msg("Re-enqueued task")
 	}
@@ -64,10 +79,132 @@ func EnqueueUnfinishedTask() error {
 }
 
 func (h *TaskHandler) enqueue() {
+	if durable() {
+		mysql.DB.Model(&model.Task{}).Where("id = ?", h.task.Id).Updates(map[string]interface{}{
+			"status":           model.TaskStatusQueued.String(),
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+		h.publishStatus(model.TaskStatusQueued, nil)
+		wakeLeaseLoop()
+		return
+	}
 	mysql.DB.Model(&model.Task{}).Where("id = ?", h.task.Id).Updates(map[string]interface{}{
 		"status": model.TaskStatusQueued.String(),
 	})
-	queue.ImageTaskQueue <- h
+	h.publishStatus(model.TaskStatusQueued, nil)
+	err := queue.ImageTaskQueue.Push(h)
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Enqueue task error")
+		h.transition(model.TaskStatusAborted, nil, model.TaskStatusQueued)
+	}
+}
+
+func (h *TaskHandler) ID() int {
+	return h.task.Id
+}
+
+func (h *TaskHandler) Priority() int {
+	return h.task.Priority
+}
+
+// Model 返回任务实际使用的模型分类，用于单模型并发限制
+func (h *TaskHandler) Model() string {
+	if h.task.Model != "" {
+		return h.task.Model
+	}
+	if h.task.Speed.Valid && h.task.Speed.String == consts.FastSpeed.String() {
+		return consts.GPTImage1.String()
+	}
+	return consts.GPT4oImage.String()
+}
+
+// timeout 任务执行超时，0 表示不限制
+func (h *TaskHandler) timeout() time.Duration {
+	if h.task.Timeout > 0 {
+		return time.Duration(h.task.Timeout) * time.Second
+	}
+	return config.Get().TaskTimeout.Duration(h.Model())
+}
+
+// transition 仅当任务处于 from 中的某个状态时才更新，避免覆盖已取消的任务
+func (h *TaskHandler) transition(to model.TaskStatus, fields map[string]interface{}, from ...model.TaskStatus) (bool, error) {
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields["status"] = to.String()
+	statuses := make([]string, 0, len(from))
+	for _, v := range from {
+		statuses = append(statuses, v.String())
+	}
+	query := mysql.DB.Model(&model.Task{}).Where("id = ? AND status IN ?", h.task.Id, statuses)
+	if h.leased {
+		// 租约已被其他实例接管时不再更新
+		query = query.Where("lease_owner = ?", leaseOwner)
+	}
+	ret := query.Updates(fields)
+	if ret.Error == nil && ret.RowsAffected > 0 {
+		h.publishStatus(to, fields)
+	}
+	return ret.RowsAffected > 0, ret.Error
+}
+
+func (h *TaskHandler) publish(typ string, data interface{}) {
+	hub.TaskHub.Publish(hub.Event{Type: typ, TaskId: h.task.Id, GroupId: h.task.TaskGroupId, Data: data})
+}
+
+func (h *TaskHandler) publishStatus(status model.TaskStatus, fields map[string]interface{}) {
+	data := response.TaskStatus{Status: status.String()}
+	if v, ok := fields["failed_reason"].(string); ok {
+		data.FailedReason = v
+	}
+	if v, ok := fields["progress"].(int); ok {
+		data.Progress = float32(v)
+	}
+	h.publish(hub.EventStatus, data)
+}
+
+// progress 更新供应商返回的生成进度
+func (h *TaskHandler) progress(p *image.Progress) {
+	err := mysql.DB.Model(&model.Task{}).
+		Where("id = ? AND status = ?", h.task.Id, model.TaskStatusRunning.String()).
+		UpdateColumn("progress", p.Progress).Error
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Update task progress error")
+	}
+	h.publish(hub.EventProgress, p)
+}
+
+// interrupt 服务退出时中断任务；持久化队列模式下直接放回队列，由其他实例接管
+func (h *TaskHandler) interrupt(from model.TaskStatus) error {
+	if h.leased {
+		if from == model.TaskStatusQueued {
+			return nil
+		}
+		_, err := h.transition(model.TaskStatusQueued, nil, from)
+		return err
+	}
+	_, err := h.transition(model.TaskStatusAborted, nil, from)
+	return err
+}
+
+func (h *TaskHandler) cancel() (bool, error) {
+	ok, err := h.transition(model.TaskStatusCancelled, nil, model.TaskStatusPending, model.TaskStatusQueued, model.TaskStatusRunning)
+	if err != nil || !ok {
+		return ok, err
+	}
+	if cancel, running := runningTasks.Load(h.task.Id); running {
+		cancel.(context.CancelCauseFunc)(errTaskCancelled)
+	}
+	logs.Logger.Info().Int("task_id", h.task.Id).Msg("Task cancelled")
+	return true, nil
+}
+
+func (h *TaskHandler) updated() {
+	select {
+	case h.alreadyUpdate <- struct{}{}:
+	default:
+	}
 }
 
 func (h *TaskHandler) fail(err error) {
@@ -79,14 +216,69 @@ func (h *TaskHandler) fail(err error) {
 		Str("status", "failed").
 		Msg("Task execution failed with exception")
 
-	mysql.DB.Model(&model.Task{}).Where("id = ?", h.task.Id).Updates(map[string]interface{}{
-		"status":        model.TaskStatusFailed.String(),
+	ok, _ := h.transition(model.TaskStatusFailed, map[string]interface{}{
 		"failed_reason": "任务执行失败，请稍后重试",
-	})
-	h.alreadyUpdate <- struct{}{}
+	}, model.TaskStatusRunning)
+	if ok {
+		h.callback()
+	}
+	h.updated()
+}
+
+// callback 任务结束后将任务 JSON 投递到创建任务时传入的 callback_url
+func (h *TaskHandler) callback() {
+	if h.task.CallbackUrl == "" {
+		return
+	}
+	tasks, err := h.list("", strconv.Itoa(h.task.Id))
+	if err != nil || len(tasks) == 0 {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Load task for callback error")
+		return
+	}
+	err = webhook.Send(h.task.Id, h.task.CallbackUrl, tasks[0])
+	if err != nil {
+		logs.Logger.Err(err).Int("task_id", h.task.Id).Msg("Send task callback error")
+	}
+}
+
+// Dispatched 任务离开队列前先登记到 runningTasks，恢复检查不会把已取出、尚未执行的任务再次入队。
+// 此时取消只需更新状态，Execute 从 queued 转为 running 会失败并跳过执行
+func (h *TaskHandler) Dispatched() {
+	runningTasks.Store(h.task.Id, context.CancelCauseFunc(func(error) {}))
 }
 
 func (h *TaskHandler) Execute(ctx context.Context) {
+	defer runningTasks.Delete(h.task.Id)
+	if h.leased {
+		defer h.releaseLease()
+	}
+	if ctx.Err() != nil {
+		// 服务退出时仍在排队的任务，下次启动时重新入队
+		err := h.interrupt(model.TaskStatusQueued)
+		if err != nil {
+			logs.Logger.Error().Err(err).Msg("Update task status error")
+		}
+		return
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	runningTasks.Store(h.task.Id, cancel)
+	defer cancel(nil)
+	if timeout := h.timeout(); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, errTaskTimeout)
+		defer cancelTimeout()
+	}
+	h.taskCtx = ctx
+	ok, err := h.transition(model.TaskStatusRunning, nil, model.TaskStatusQueued)
+	if err != nil {
+		logs.Logger.Error().Err(err).Int("task_id", h.task.Id).Msg("Update task status error")
+		return
+	}
+	if !ok {
+		// 排队期间已被取消
+		logs.Logger.Info().Int("task_id", h.task.Id).Msg("Task is no longer queued, skip execution")
+		return
+	}
 	// 记录任务开始执行日志
 	logs.Logger.Info().
 		Int("task_id", h.task.Id).
@@ -94,9 +286,6 @@ func (h *TaskHandler) Execute(ctx context.Context) {
 		Str("model", h.task.Model).
 		Str("status", "started").
 		Msg("Task execution started")
-	mysql.DB.Model(&model.Task{}).Where("id = ?", h.task.Id).Updates(map[string]interface{}{
-		"status": model.TaskStatusRunning.String(),
-	})
 	switch h.task.Type {
 	case consts.TaskTypeEdit.String():
 		h.edit(ctx)
@@ -120,104 +309,61 @@ func (h *TaskHandler) edit(ctx context.Context) {
 		return
 	}
 	urls, _ := h.inputImageURLs()
-	logs.Logger.Info().
-		Int("task_id", h.task.Id).
-		Str("model", h.task.Model).
-		Msg("Calling image supplier")
-	if h.task.Speed.Valid && h.task.Speed.String == consts.SlowSpeed.String() {
-		editRequest := gpt.SlowRequest{
-			ImageBytes: bs,
-			Prompt:     h.task.Prompt,
-			Model:      h.task.Model,
-			TaskID:     h.task.Id,
-		}
-		gpt.NewProvider(ctx, []observer.Observer{h}).SlowSpeed(editRequest)
-	} else if h.task.Speed.Valid && h.task.Speed.String == consts.FastSpeed.String() {
-		editRequest := gpt.FastRequest{
-			ImageBytes: bs,
-			Prompt:     h.task.Prompt,
-			Quality:    h.task.Quality,
-			Size:       h.task.Size,
-			TaskID:     h.task.Id,
-		}
-		gpt.NewProvider(ctx, []observer.Observer{h}).FastSpeed(editRequest)
-	} else if strings.HasPrefix(h.task.Model, "gemini") {
-		req := gemini.Request{
-			ImageBytes: bs,
-			Prompt:     h.task.Prompt,
-			Model:      h.task.Model,
-			TaskID:     h.task.Id,
-		}
-		gemini.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else if strings.HasPrefix(h.task.Model, "jimeng") {
-		req := volc.Request{
-			ImageURLs:  urls,
-			ImageBytes: bs,
-			Prompt:     h.task.Prompt,
-			Size:       h.task.Size,
-			TaskID:     h.task.Id,
-		}
-		volc.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else if h.task.Model == consts.MidJourney.String() {
-		prompt := h.task.Prompt
-		if !strings.Contains(prompt, "--sref") {
-			prompt = strings.TrimSpace(prompt) + fmt.Sprintf(" --sref %s", strings.Join(urls, " "))
-		}
-		req := mj.Request{
-			ImageURLs:  urls,
-			ImageBytes: bs,
-			Prompt:     prompt,
-			TaskID:     h.task.Id,
-		}
-		mj.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else {
-		h.fail(fmt.Errorf("not support model: %s", h.task.Model))
-	}
+	h.run(ctx, image.Input{
+		TaskID:     h.task.Id,
+		Model:      h.Model(),
+		Prompt:     h.task.Prompt,
+		ImageBytes: bs,
+		ImageURLs:  urls,
+		Quality:    h.task.Quality,
+		Size:       h.task.Size,
+	})
 }
 
 func (h *TaskHandler) generate(ctx context.Context) {
+	h.run(ctx, image.Input{
+		TaskID:  h.task.Id,
+		Model:   h.Model(),
+		Prompt:  h.task.Prompt,
+		Quality: h.task.Quality,
+		Size:    h.task.Size,
+	})
+}
+
+// run 按模型分类的供应商接口执行任务
+func (h *TaskHandler) run(ctx context.Context, input image.Input) {
 	logs.Logger.Info().
 		Int("task_id", h.task.Id).
-		Str("model", h.task.Model).
+		Str("model", input.Model).
 		Msg("Calling image supplier")
-	if h.task.Speed.Valid && h.task.Speed.String == consts.SlowSpeed.String() {
-		editRequest := gpt.SlowRequest{
-			Prompt: h.task.Prompt,
-			Model:  h.task.Model,
-			TaskID: h.task.Id,
-		}
-		gpt.NewProvider(ctx, []observer.Observer{h}).SlowSpeed(editRequest)
-	} else if h.task.Speed.Valid && h.task.Speed.String == consts.FastSpeed.String() {
-		editRequest := gpt.FastRequest{
-			Prompt:  h.task.Prompt,
-			Quality: h.task.Quality,
-			Size:    h.task.Size,
-			TaskID:  h.task.Id,
-		}
-		gpt.NewProvider(ctx, []observer.Observer{h}).FastSpeed(editRequest)
-	} else if strings.HasPrefix(h.task.Model, "gemini") {
-		req := gemini.Request{
-			Prompt: h.task.Prompt,
-			Model:  h.task.Model,
-			TaskID: h.task.Id, // 传递TaskID
-		}
-		gemini.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else if strings.HasPrefix(h.task.Model, "jimeng") {
-		req := volc.Request{
-			Prompt: h.task.Prompt,
-			Size:   h.task.Size,
-			TaskID: h.task.Id,
-		}
-		volc.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else if h.task.Model == consts.MidJourney.String() {
-		req := mj.Request{
-			Prompt: h.task.Prompt,
-			TaskID: h.task.Id,
-		}
-		mj.NewProvider(ctx, []observer.Observer{h}).Create(req)
-	} else {
-		h.fail(fmt.Errorf("not support model: %s", h.task.Model))
+	provider := image.GetProvider(config.Get().ProviderKind(input.Model))
+	if provider == nil {
+		h.fail(fmt.Errorf("not support model: %s", input.Model))
+		return
+	}
+	image.NewExecutor(ctx, []observer.Observer{h}, h.tokenOptions()...).Run(provider, input)
+}
+
+// supportedModel 模型分类已在 request_order 中配置且能确定供应商接口类型
+func supportedModel(model string) bool {
+	return config.Get().ProviderKind(model) != "" && ai.GetTokenManager(model) != nil
+}
+
+func (h *TaskHandler) tokenOptions() []ai.IteratorOption {
+	var ret []ai.IteratorOption
+	if h.task.Supplier != "" {
+		ret = append(ret, ai.WithSupplier(consts.ModelSupplier(h.task.Supplier)))
+	}
+	if h.task.CostCap > 0 {
+		ret = append(ret, ai.WithCostCap(h.task.CostCap))
+	}
+	if h.task.Prefer != "" {
+		ret = append(ret, ai.WithPrefer(ai.Prefer(h.task.Prefer)))
+	}
+	if opt := h.affinityOption(); opt != nil {
+		ret = append(ret, opt)
 	}
+	return ret
 }
 
 func (h *TaskHandler) inputImageBytes() (ret [][]byte, err error) {
@@ -233,7 +379,7 @@ func (h *TaskHandler) inputImageBytes() (ret [][]byte, err error) {
 			path = img.InputImage.Path
 			key = img.InputImage.Key
 		}
-		b, err := tools.ReadFile(filepath.Join(config.GConfig.LocalStorageDirectory, path))
+		b, err := tools.ReadFile(filepath.Join(config.Get().LocalStorageDirectory, path))
 		if err != nil {
 			logs.Logger.Err(err).Msg("Read-LocalFile")
 		} else {
@@ -241,7 +387,7 @@ func (h *TaskHandler) inputImageBytes() (ret [][]byte, err error) {
 			continue
 		}
 
-		if !config.GConfig.CloudStorageEnabled {
+		if !config.Get().CloudStorageEnabled {
 			return nil, fmt.Errorf("cloud storage is not enabled, cannot get input image bytes")
 		}
 		url, err := ali.OssClient.URL(key, time.Hour)
@@ -271,7 +417,7 @@ func (h *TaskHandler) inputImageURLs() ([]string, error) {
 		} else {
 			key = img.InputImage.Key
 		}
-		if !config.GConfig.CloudStorageEnabled {
+		if !config.Get().CloudStorageEnabled {
 			return nil, fmt.Errorf("cloud storage is not enabled, cannot get input image bytes")
 		}
 		url, err := ali.OssClient.URL(key, time.Hour)
@@ -294,6 +440,12 @@ func (h *TaskHandler) createTask(form request.TaskForm) error {
 		Quality:     form.GetQuality(),
 		Size:        form.GetSize(),
 		Status:      model.TaskStatusPending.String(),
+		Priority:    form.GetPriority(),
+		CallbackUrl: form.GetCallbackUrl(),
+		Timeout:     form.GetTimeout(),
+		CostCap:     form.GetCostCap(),
+		Prefer:      form.GetPrefer(),
+		Sticky:      form.GetSticky(),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -343,152 +495,86 @@ func (h *TaskHandler) createTaskRecord(form any) error {
 	return fmt.Errorf("unknown task form type: %T", form)
 }
 
-func (h *TaskHandler) createImageRecords(imageResp image.Response) error {
-	err := h.createNormalRecords(imageResp)
+func (h *TaskHandler) createNormalRecord(b []byte, result *model.SupplierResult) (int, error) {
+	path, err := saveNormalImage(b, h.task.CreatedAt, result.SupplierName)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	err = h.createCompressionRecords(imageResp)
+	thumbnailPath, err := saveThumbnailImage(b, h.task.CreatedAt, result.SupplierName)
 	if err != nil {
-		return err
+		logs.Logger.Err(err).Msg("save thumbnail image error")
 	}
-	return nil
-}
-func (h *TaskHandler) createNormalRecords(imageResp image.Response) error {
-	type imageData struct {
-		URL  string `json:"url"`
-		Byte []byte `json:"byte"`
+	imageRecord := model.OutputImage{
+		Path:              path,
+		ThumbNailPath:     thumbnailPath,
+		TTL:               0,
+		Type:              string(model.OuputImageTypeNormal),
+		ModelSupplierURL:  result.URL,
+		ModelSupplierName: result.SupplierName,
+		ModelName:         result.ModelName,
 	}
-	result := make([]imageData, 0)
-	for _, v := range imageResp.GetURLs() {
-		b, _, err := tools.GetOnlineImage(v)
+	if config.Get().CloudStorageEnabled {
+		normal, err := uploadNormalImage(b)
 		if err != nil {
-			logs.Logger.Err(err).Msg("GetOnlineImage Error")
-			return err
-		}
-		result = append(result, imageData{URL: v, Byte: b})
-	}
-	for _, v := range imageResp.GetB64s() {
-		decoded, err := base64.StdEncoding.DecodeString(v)
-		if err != nil {
-			return err
+			return 0, err
 		}
-		result = append(result, imageData{URL: "", Byte: decoded})
+		imageRecord.StorageSupplierName = config.Get().CloudStorageSupplier
+		imageRecord.Key = normal.Key
+		imageRecord.ACL = "private"
+		imageRecord.URL = normal.URL
 	}
-
-	for _, v := range result {
-		path, err := saveNormalImage(v.Byte, h.task.CreatedAt, imageResp.GetSupplier())
-		if err != nil {
-			return err
-		}
-		thumbnailPath, err := saveThumbnailImage(v.Byte, h.task.CreatedAt, imageResp.GetSupplier())
-		if err != nil {
-			logs.Logger.Err(err).Msg("save thumbnail image error")
-		}
-		imageRecord := model.OutputImage{
-			Path:              path,
-			ThumbNailPath:     thumbnailPath,
-			TTL:               0,
-			Type:              string(model.OuputImageTypeNormal),
-			ModelSupplierURL:  v.URL,
-			ModelSupplierName: imageResp.GetSupplier(),
-			ModelName:         imageResp.GetModel(),
-		}
-		if config.GConfig.CloudStorageEnabled {
-			normal, err := uploadNormalImage(v.Byte)
-			if err != nil {
-				return err
-			}
-			imageRecord.StorageSupplierName = config.GConfig.CloudStorageSupplier
-			imageRecord.Key = normal.Key
-			imageRecord.ACL = "private"
-			imageRecord.URL = normal.URL
-		}
-		err = mysql.DB.Model(&model.OutputImage{}).Create(&imageRecord).Error
-		if err != nil {
-			return err
-		}
-		taskImageRecord := model.TaskImage{
-			TaskId:  h.task.Id,
-			ImageId: imageRecord.Id,
-			Type:    model.TaskImageTypeOutput.String(),
-			Origin:  sql.NullString{Valid: false},
-		}
-		err = mysql.DB.Model(&model.TaskImage{}).Create(&taskImageRecord).Error
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	return h.createOutputRecord(&imageRecord)
 }
 
-func (h *TaskHandler) createCompressionRecords(imageResp image.Response) error {
-	type imageData struct {
-		URL  string `json:"url"`
-		Byte []byte `json:"byte"`
+func (h *TaskHandler) createCompressionRecord(b []byte, result *model.SupplierResult) (int, error) {
+	path, ratio, err := saveCompressionImage(b, 95, h.task.CreatedAt, result.SupplierName)
+	if err != nil {
+		return 0, err
 	}
-	result := make([]imageData, 0)
-	for _, v := range imageResp.GetURLs() {
-		b, _, err := tools.GetOnlineImage(v)
-		if err != nil {
-			logs.Logger.Err(err).Msg("GetOnlineImage Error")
-			return err
-		}
-		result = append(result, imageData{URL: v, Byte: b})
+	thumbnailPath, err := saveCompressionThumbnailImage(b, 95, h.task.CreatedAt, result.SupplierName)
+	if err != nil {
+		logs.Logger.Err(err).Msg("save thumbnail image error")
+	}
+	imageRecord := model.OutputImage{
+		Path:              path,
+		ThumbNailPath:     thumbnailPath,
+		TTL:               0,
+		Type:              string(model.OuputImageTypeCompressed),
+		CompressionRatio:  sql.NullFloat64{Valid: true, Float64: ratio},
+		ModelSupplierURL:  result.URL,
+		ModelSupplierName: result.SupplierName,
+		ModelName:         result.ModelName,
 	}
-	for _, v := range imageResp.GetB64s() {
-		decoded, err := base64.StdEncoding.DecodeString(v)
+	if config.Get().CloudStorageEnabled {
+		compression, _, err := uploadCompressionImage(b, 95)
 		if err != nil {
-			return err
+			return 0, err
 		}
-		result = append(result, imageData{URL: "", Byte: decoded})
+		imageRecord.StorageSupplierName = config.Get().CloudStorageSupplier
+		imageRecord.Key = compression.Key
+		imageRecord.ACL = "private"
+		imageRecord.URL = compression.URL
 	}
+	return h.createOutputRecord(&imageRecord)
+}
 
-	for _, v := range result {
-		path, ratio, err := saveCompressionImage(v.Byte, 95, h.task.CreatedAt, imageResp.GetSupplier())
-		if err != nil {
-			return err
-		}
-		thumbnailPath, err := saveCompressionThumbnailImage(v.Byte, 95, h.task.CreatedAt, imageResp.GetSupplier())
-		if err != nil {
-			logs.Logger.Err(err).Msg("save thumbnail image error")
-		}
-		imageRecord := model.OutputImage{
-			Path:              path,
-			ThumbNailPath:     thumbnailPath,
-			TTL:               0,
-			Type:              string(model.OuputImageTypeCompressed),
-			CompressionRatio:  sql.NullFloat64{Valid: true, Float64: ratio},
-			ModelSupplierURL:  v.URL,
-			ModelSupplierName: imageResp.GetSupplier(),
-			ModelName:         imageResp.GetModel(),
-		}
-		if config.GConfig.CloudStorageEnabled {
-			compression, _, err := uploadCompressionImage(v.Byte, 95)
-			if err != nil {
-				return err
-			}
-			imageRecord.StorageSupplierName = config.GConfig.CloudStorageSupplier
-			imageRecord.Key = compression.Key
-			imageRecord.ACL = "private"
-			imageRecord.URL = compression.URL
-		}
-		err = mysql.DB.Model(&model.OutputImage{}).Create(&imageRecord).Error
-		if err != nil {
-			return err
-		}
-		taskImageRecord := model.TaskImage{
-			TaskId:  h.task.Id,
-			ImageId: imageRecord.Id,
-			Type:    model.TaskImageTypeOutput.String(),
-			Origin:  sql.NullString{Valid: false},
-		}
-		err = mysql.DB.Model(&model.TaskImage{}).Create(&taskImageRecord).Error
-		if err != nil {
-			return err
-		}
+func (h *TaskHandler) createOutputRecord(imageRecord *model.OutputImage) (int, error) {
+	err := mysql.DB.Model(&model.OutputImage{}).Create(imageRecord).Error
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	taskImageRecord := model.TaskImage{
+		TaskId:  h.task.Id,
+		ImageId: imageRecord.Id,
+		Type:    model.TaskImageTypeOutput.String(),
+		Origin:  sql.NullString{Valid: false},
+		Run:     h.task.RetryCount,
+	}
+	err = mysql.DB.Model(&model.TaskImage{}).Create(&taskImageRecord).Error
+	if err != nil {
+		return 0, err
+	}
+	return imageRecord.Id, nil
 }
 
 func (h *TaskHandler) recordSupplierInvoke() error {
@@ -500,6 +586,8 @@ func (h *TaskHandler) recordSupplierInvoke() error {
 			ModelName:    v.GetModel(),
 			StatusCode:   v.GetStatusCode(),
 			DurationMs:   v.TaskConsumeMs(),
+			Price:        v.GetPrice(),
+			Run:          h.task.RetryCount,
 			CreatedAt:    v.GetRespAt(),
 		}
 		respBody := v.GetRespBody()
@@ -508,6 +596,7 @@ func (h *TaskHandler) recordSupplierInvoke() error {
 				exeRecord.FailedRespBody = respBody
 			}
 			exeRecord.Error = v.GetError().Error()
+			exeRecord.Cancelled = errors.Is(v.GetError(), image.CancelledError)
 		}
 		err := mysql.DB.Model(&model.SupplierInvokeHistory{}).Create(&exeRecord).Error
 		if err != nil {
@@ -518,20 +607,43 @@ func (h *TaskHandler) recordSupplierInvoke() error {
 }
 
 func (h *TaskHandler) Update(event int, data interface{}) {
-	if event == consts.EventTaskEnd {
+	switch event {
+	case consts.EventAttempt:
+		h.publish(hub.EventAttempt, data)
+		return
+	case consts.EventProgress:
+		h.progress(data.(*image.Progress))
+		return
+	case consts.EventTaskEnd:
 		h.imageResponse = data.([]image.Response)
 		err := h.endWork()
 		if err != nil {
 			h.fail(err)
 		}
-	} else if event == consts.EventSysExit {
+	case consts.EventSysExit:
 		data := data.(image.SysExitResponse)
-		err := mysql.DB.Model(&model.Task{}).Where("id = ?", data.GetTaskID()).Update("status", model.TaskStatusAborted).Error
-		if err != nil {
-			logs.Logger.Error().Err(err).Msg("Update task status error")
+		cause := context.Cause(h.taskCtx)
+		if errors.Is(cause, errTaskCancelled) {
+			logs.Logger.Info().Int("task_id", data.GetTaskID()).Msg("Task supplier calls stopped by cancellation")
+		} else if errors.Is(cause, errTaskTimeout) {
+			ok, err := h.transition(model.TaskStatusFailed, map[string]interface{}{
+				"failed_reason": failedReasonTimeout,
+			}, model.TaskStatusRunning)
+			if err != nil {
+				logs.Logger.Error().Err(err).Msg("Update task status error")
+			}
+			if ok {
+				h.callback()
+			}
+			logs.Logger.Warn().Int("task_id", data.GetTaskID()).Dur("timeout", h.timeout()).Msg("Task execution timeout")
+		} else {
+			err := h.interrupt(model.TaskStatusRunning)
+			if err != nil {
+				logs.Logger.Error().Err(err).Msg("Update task status error")
+			}
 		}
 	}
-	h.alreadyUpdate <- struct{}{}
+	h.updated()
 }
 
 func (h *TaskHandler) endWork() error {
@@ -544,32 +656,21 @@ func (h *TaskHandler) endWork() error {
 	errs := make([]error, 0)
 	for _, v := range h.imageResponse {
 		if v.Succeed() {
-			succeed = true
-			err := h.createImageRecords(v)
-			if err != nil {
-				return err
-			}
-			taskRecord := model.Task{
-				Id:       h.task.Id,
-				Status:   model.TaskStatusSucceed.String(),
-				Progress: 100,
+			if !succeed {
+				h.saveAffinity(v)
 			}
-			if h.task.Model == "" {
-				taskRecord.Model = v.GetModel()
-			}
-			err = mysql.DB.Updates(&taskRecord).Error
+			succeed = true
+			// 先保存供应商返回的原始结果，后续处理失败时可重试
+			err := h.stageResults(v)
 			if err != nil {
 				return err
 			}
-
-			// 记录任务成功完成日志
 			logs.Logger.Info().
 				Int("task_id", h.task.Id).
 				Str("supplier", v.GetSupplier()).
 				Str("model", v.GetModel()).
-				Str("status", "success").
 				Int64("task_consume_ms", v.TaskConsumeMs()).
-				Msg("Task completed successfully")
+				Msg("Supplier results staged")
 		} else {
 			err := v.GetError()
 			if err != nil {
@@ -577,7 +678,9 @@ func (h *TaskHandler) endWork() error {
 			}
 		}
 	}
-	if !succeed {
+	if succeed {
+		return h.processResults()
+	} else {
 		var failReason string
 		for _, err := range errs {
 			if errors.Is(err, image.PromptError) {
@@ -585,15 +688,15 @@ func (h *TaskHandler) endWork() error {
 				break
 			}
 		}
-		taskRecord := model.Task{
-			Id:           h.task.Id,
-			Status:       model.TaskStatusFailed.String(),
-			FailedReason: failReason,
-		}
-		err := mysql.DB.Updates(&taskRecord).Error
+		ok, err := h.transition(model.TaskStatusFailed, map[string]interface{}{
+			"failed_reason": failReason,
+		}, model.TaskStatusRunning)
 		if err != nil {
 			return err
 		}
+		if ok {
+			h.callback()
+		}
 
 		// 记录任务失败日志
 		logs.Logger.Error().
@@ -628,6 +731,34 @@ func (h *TaskHandler) list(groupId, id string) ([]model.Task, error) {
 	return tasks, nil
 }
 
+func (h *TaskHandler) positions(groupId, id string) ([]response.TaskPosition, error) {
+	var tasks []model.Task
+	query := mysql.DB.Model(&model.Task{}).Select("id", "status", "priority", "updated_at")
+	if groupId != "" {
+		query = query.Where("task_group_id = ?", groupId)
+	}
+	if id != "" {
+		query = query.Where("id = ?", id)
+	}
+	err := query.Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]response.TaskPosition, 0, len(tasks))
+	for _, task := range tasks {
+		p := response.TaskPosition{TaskId: task.Id, Status: task.Status, Priority: task.Priority}
+		if task.Status == model.TaskStatusQueued.String() {
+			var ok bool
+			p.Position, ok = queue.ImageTaskQueue.Position(task.Id)
+			if !ok && durable() {
+				p.Position = durablePosition(task)
+			}
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
 func SlowSpeed(c *gin.Context) {
 	form := request.SlowTask{}
 	err := c.ShouldBind(&form)
@@ -635,6 +766,11 @@ func SlowSpeed(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response.ParamError)
 		return
 	}
+	err = form.Valid()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
 	if c.FullPath() == "/v2/task/slow/4oVip-four" {
 		form.Prompt = form.Prompt + consts.FourImagePrompt
 	}
@@ -660,6 +796,11 @@ func FastSpeed(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response.ParamError)
 		return
 	}
+	err = form.Valid()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
 	h, err := newTaskHandler(c)
 	if err != nil {
 		logs.Logger.Err(err).Msg("task-FastSpeed-NewTaskHandler")
@@ -683,6 +824,11 @@ func Generate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response.ParamError)
 		return
 	}
+	err = form.Valid()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
 	if c.FullPath() == "/v2/task/generate/4oVip-four" {
 		form.Prompt = form.Prompt + consts.FourImagePrompt
 	}
@@ -715,6 +861,23 @@ func TaskQuery(c *gin.Context) {
 	c.JSON(http.StatusOK, response.SuccessWithData(tasks))
 }
 
+func TaskPosition(c *gin.Context) {
+	id := c.Query("id")
+	groupId := c.Query("group_id")
+	if id == "" && groupId == "" {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	h := TaskHandler{}
+	positions, err := h.positions(groupId, id)
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-TaskPosition")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(positions))
+}
+
 func Create(c *gin.Context) {
 	form := request.Create{}
 	err := c.ShouldBind(&form)
@@ -722,6 +885,15 @@ func Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, response.ParamError)
 		return
 	}
+	err = form.Valid()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	if !supportedModel(form.Model) {
+		c.JSON(http.StatusBadRequest, response.ModelNotSupported)
+		return
+	}
 	h, err := newTaskHandler(c)
 	if err != nil {
 		logs.Logger.Err(err).Msg("task-Generate-NewTaskHandler")
@@ -738,9 +910,37 @@ func Create(c *gin.Context) {
 	c.JSON(http.StatusOK, response.SuccessWithData(h.task.TidyImageTask()))
 }
 
+func Cancel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	var task model.Task
+	err = mysql.DB.Model(&model.Task{}).Select("id", "task_group_id").Where("id = ?", id).Find(&task).Error
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-Cancel")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	task.Id = id
+	h := TaskHandler{task: &task}
+	ok, err := h.cancel()
+	if err != nil {
+		logs.Logger.Err(err).Msg("task-Cancel")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, response.TaskNotCancelable)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(nil))
+}
+
 func saveNormalImage(image []byte, t time.Time, supplier string) (relativePath string, err error) {
 	relativePath = filepath.Join("output", "o", t.Format("20060102"), supplier, uuid.New().String()+"."+tools.DetectImageType(image).String())
-	path := filepath.Join(config.GConfig.LocalStorageDirectory, relativePath)
+	path := filepath.Join(config.Get().LocalStorageDirectory, relativePath)
 	err = local.SaveFile(bytes.NewReader(image), path)
 	return
 }
@@ -752,7 +952,7 @@ func saveCompressionImage(image []byte, quality int, t time.Time, supplier strin
 	}
 	ratio = float64(len(compressionBytes)) / float64(len(image))
 	relativePath = filepath.Join("output", "c", t.Format("20060102"), supplier, uuid.New().String()+"."+tools.DetectImageType(compressionBytes).String())
-	path := filepath.Join(config.GConfig.LocalStorageDirectory, relativePath)
+	path := filepath.Join(config.Get().LocalStorageDirectory, relativePath)
 	err = local.SaveFile(bytes.NewReader(compressionBytes), path)
 	return
 }
@@ -764,7 +964,7 @@ func saveThumbnailImage(image []byte, t time.Time, supplier string) (relativePat
 	}
 	thumbnail, err := tools.Thumbnail(bytes.NewReader(image), 0.5, format)
 	relativePath = filepath.Join("output", "ot", t.Format("20060102"), supplier, uuid.New().String()+"."+strings.ToLower(format.String()))
-	path := filepath.Join(config.GConfig.LocalStorageDirectory, relativePath)
+	path := filepath.Join(config.Get().LocalStorageDirectory, relativePath)
 	err = local.SaveFile(thumbnail, path)
 	return
 }
@@ -780,7 +980,7 @@ func saveCompressionThumbnailImage(image []byte, quality int, t time.Time, suppl
 	}
 	thumbnail, err := tools.Thumbnail(bytes.NewReader(compressionBytes), 0.5, format)
 	relativePath = filepath.Join("output", "ct", t.Format("20060102"), supplier, uuid.New().String()+"."+strings.ToLower(format.String()))
-	path := filepath.Join(config.GConfig.LocalStorageDirectory, relativePath)
+	path := filepath.Join(config.Get().LocalStorageDirectory, relativePath)
 	err = local.SaveFile(thumbnail, path)
 	return
 }
@@ -791,7 +991,7 @@ func uploadNormalImage(image []byte) (normal ali.OSSObject, err error) {
 		return
 	}
 	// 配置初始化时已校验
-	duration, _ := time.ParseDuration(config.GConfig.URLExpires)
+	duration, _ := time.ParseDuration(config.Get().URLExpires)
 	presignRet, err := ali.OssClient.Presign(key, duration)
 	if err != nil {
 		return
@@ -813,7 +1013,7 @@ func uploadCompressionImage(image []byte, quality int) (compression ali.OSSObjec
 		return
 	}
 	// 配置初始化时已校验
-	duration, _ := time.ParseDuration(config.GConfig.URLExpires)
+	duration, _ := time.ParseDuration(config.Get().URLExpires)
 	presignRet, err := ali.OssClient.Presign(key, duration)
 	if err != nil {
 		return
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/internal/modules/ai"
+	"github.com/reusedev/draw-hub/internal/modules/budget"
+	"github.com/reusedev/draw-hub/internal/modules/prober"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+)
+
+// TokenBreakers 各模型下 token 的熔断状态，可通过 model 参数过滤
+func TokenBreakers(c *gin.Context) {
+	model := c.Query("model")
+	ret := make(map[string][]ai.TokenBreaker)
+	for k, manager := range ai.TokenManagers() {
+		if model != "" && k != model {
+			continue
+		}
+		ret[k] = manager.BreakerStates()
+	}
+	if model != "" && len(ret) == 0 {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(ret))
+}
+
+// TokenBudgets 配置了预算的 token 在当前周期的剩余额度
+func TokenBudgets(c *gin.Context) {
+	if budget.GTracker == nil {
+		c.JSON(http.StatusOK, response.SuccessWithData([]budget.Remaining{}))
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(budget.GTracker.Remainings()))
+}
+
+// TokenHealth 各 token 最近一次健康探测的结果，未开启探测时为空
+func TokenHealth(c *gin.Context) {
+	if prober.GProber == nil {
+		c.JSON(http.StatusOK, response.SuccessWithData([]prober.Health{}))
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(prober.GProber.Health()))
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/internal/modules/logs"
+	"github.com/reusedev/draw-hub/internal/modules/webhook"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+)
+
+func WebhookDeliveries(c *gin.Context) {
+	var taskId int
+	if v := c.Query("task_id"); v != "" {
+		var err error
+		taskId, err = strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.ParamError)
+			return
+		}
+	}
+	deliveries, err := webhook.Deliveries(taskId, c.Query("status"))
+	if err != nil {
+		logs.Logger.Err(err).Msg("webhook-Deliveries")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(deliveries))
+}
+
+func WebhookReplay(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.ParamError)
+		return
+	}
+	err = webhook.Replay(id)
+	if errors.Is(err, webhook.ErrDeliveryNotFound) || errors.Is(err, webhook.ErrDeliveryPending) || errors.Is(err, webhook.ErrDisabled) {
+		c.JSON(http.StatusBadRequest, response.DeliveryNotReplayable)
+		return
+	}
+	if err != nil {
+		logs.Logger.Err(err).Msg("webhook-Replay")
+		c.JSON(http.StatusInternalServerError, response.InternalError)
+		return
+	}
+	c.JSON(http.StatusOK, response.SuccessWithData(nil))
+}
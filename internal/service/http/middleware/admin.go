@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/reusedev/draw-hub/config"
+	"github.com/reusedev/draw-hub/internal/service/http/handler/response"
+)
+
+// AdminAuth 校验 Authorization: Bearer <admin.token>，未配置 token 时关闭管理接口
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := config.Get().Admin.Token
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, response.AdminDisabled)
+			return
+		}
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response.Unauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -10,7 +10,8 @@ import (
 
 func isDrawApi(path string) bool {
 
-	return strings.Contains(path, "/task/slow") || strings.Contains(path, "/task/fast")
+	return strings.Contains(path, "/task/slow") || strings.Contains(path, "/task/fast") ||
+		strings.Contains(path, "/task/stream")
 }
 
 func RequestLogger() gin.HandlerFunc {
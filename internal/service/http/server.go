@@ -55,6 +55,26 @@ func initRouter(e *gin.Engine) {
 	taskV3 := v3.Group("/task")
 	{
 		taskV3.POST("/create", handler.Create)
+		taskV3.POST("/cancel", handler.Cancel)
+		taskV3.POST("/retry", handler.Retry)
+		taskV3.GET("/position", handler.TaskPosition)
+		taskV3.GET("/stream", handler.TaskStream)
+	}
+	webhookV3 := v3.Group("/webhook", middleware.AdminAuth())
+	{
+		webhookV3.GET("/deliveries", handler.WebhookDeliveries)
+		webhookV3.POST("/replay", handler.WebhookReplay)
+	}
+	adminV3 := v3.Group("/admin", middleware.AdminAuth())
+	{
+		adminV3.POST("/reload", handler.ReloadConfig)
+		adminV3.GET("/tokens", handler.AdminTokens)
+		adminV3.POST("/token/:action", handler.AdminTokenAction)
+		adminV3.GET("/token/breakers", handler.TokenBreakers)
+		adminV3.GET("/token/budgets", handler.TokenBudgets)
+		adminV3.GET("/token/health", handler.TokenHealth)
+		adminV3.GET("/audits", handler.AdminAudits)
+		adminV3.POST("/error_rules/test", handler.TestErrorRule)
 	}
 	chat := v1.Group("/chat")
 	{
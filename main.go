@@ -5,13 +5,15 @@ import (
 	"flag"
 	"github.com/reusedev/draw-hub/config"
 	"github.com/reusedev/draw-hub/internal/components/mysql"
+	"github.com/reusedev/draw-hub/internal/modules/budget"
 	"github.com/reusedev/draw-hub/internal/modules/logs"
 	"github.com/reusedev/draw-hub/internal/modules/model"
+	"github.com/reusedev/draw-hub/internal/modules/prober"
 	"github.com/reusedev/draw-hub/internal/modules/queue"
 	"github.com/reusedev/draw-hub/internal/modules/storage/ali"
+	"github.com/reusedev/draw-hub/internal/modules/webhook"
 	"github.com/reusedev/draw-hub/internal/service/http"
 	"github.com/reusedev/draw-hub/internal/service/http/handler"
-	"github.com/reusedev/draw-hub/tools"
 	"os"
 	"os/signal"
 	"sync"
@@ -31,18 +33,27 @@ func init() {
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	flag.Parse()
-	config.Init(tools.PanicOnError(tools.ReadFile(configPath)))
+	config.InitFile(configPath)
 	config.InitTokenManager(ctx)
 	logs.InitLogger()
 	syscall.Umask(0007)
 	wg := &sync.WaitGroup{}
-	queue.InitImageTaskQueue(ctx, wg)
-	mysql.CreateDataBase(config.GConfig.MySQL)
-	mysql.InitMySQL(config.GConfig.MySQL)
-	mysql.DB.AutoMigrate(&model.InputImage{}, &model.OutputImage{}, &model.Task{}, &model.TaskImage{}, &model.SupplierInvokeHistory{})
+	conf := config.Get()
+	queue.InitImageTaskQueue(ctx, wg, conf.TaskQueue)
+	mysql.CreateDataBase(conf.MySQL)
+	mysql.InitMySQL(conf.MySQL)
+	mysql.DB.AutoMigrate(&model.InputImage{}, &model.OutputImage{}, &model.Task{}, &model.TaskImage{}, &model.SupplierInvokeHistory{}, &model.SupplierResult{}, &model.WebhookDelivery{}, &model.TokenUsage{}, &model.AdminAudit{}, &model.TaskGroupAffinity{})
 	mysql.FieldMigrate()
-	ali.InitOSS(config.GConfig.AliOss)
+	ali.InitOSS(conf.AliOss)
+	budget.Init(ctx)
+	prober.Init(ctx)
+	webhook.Init(ctx)
+	handler.StartTaskRecovery(ctx)
 	handler.EnqueueUnfinishedTask()
+	if conf.TaskQueue.Durable {
+		handler.StartDurableQueue(ctx)
+	}
+	handler.StartResultProcessor(ctx)
 	osSignal := make(chan os.Signal, 1)
 	signal.Notify(osSignal, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	go func(ch chan os.Signal) {
@@ -51,5 +62,16 @@ func main() {
 		wg.Wait()
 		os.Exit(0)
 	}(osSignal)
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	go func(ch chan os.Signal) {
+		for range ch {
+			if err := config.Reload(); err != nil {
+				logs.Logger.Err(err).Msg("Reload config error")
+				continue
+			}
+			logs.Logger.Info().Msg("Config reloaded")
+		}
+	}(reloadSignal)
 	http.Serve(httpPort)
 }
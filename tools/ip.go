@@ -0,0 +1,9 @@
+package tools
+
+import "net"
+
+// InternalIP 回环、内网、链路本地（含云厂商元数据地址 169.254.169.254）、未指定和组播地址
+func InternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}